@@ -0,0 +1,145 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/BurntSushi/toml"
+	"github.com/tdemin/gmnhg/internal/gmnhg"
+)
+
+// redirect maps an alias URL path to the page it points to.
+type redirect struct {
+	From, To string
+	// alias stub file relative to the output dir
+	file string
+	page gmnhg.Post
+	// content file of the page
+	source string
+}
+
+// aliasPath returns the URL path of a page alias, and the path of the
+// alias stub file relative to the output dir. Aliases without a leading
+// slash are relative to the page directory, and the other ones to the
+// output subdir of the page language, prefix. Aliases with no extension
+// are treated as directories, and web page extensions are replaced with
+// .gmi.
+func aliasPath(prefix, pageLink, alias string) (urlPath, file string) {
+	isDir := strings.HasSuffix(alias, "/")
+	if path.IsAbs(alias) {
+		// cleaned first so that aliases can't leave the subdir
+		alias = path.Join("/", prefix, path.Clean(alias))
+	} else {
+		alias = path.Join("/", path.Dir(pageLink), alias)
+	}
+	alias = path.Clean(alias)
+	switch ext := path.Ext(alias); ext {
+	case "":
+		isDir = true
+	case ".html", ".htm":
+		alias = strings.TrimSuffix(alias, ext) + ".gmi"
+	}
+	if isDir {
+		if alias == "/" {
+			return alias, indexFilename
+		}
+		return alias + "/", path.Join(alias, indexFilename)[1:]
+	}
+	return alias, alias[1:]
+}
+
+// renderAliases writes stub pages linking to the canonical pages for
+// all aliases of posts in the language with the output subdir prefix,
+// returning the list of redirects made.
+func renderAliases(out *outputDir, prefix string, siteConf SiteConfig, tmpl *template.Template, posts gmnhg.Posts) ([]redirect, error) {
+	var redirects []redirect
+	for _, post := range posts {
+		// pages with no matching layout are not rendered
+		if !out.exists(path.Join(out.path, post.Link)) {
+			continue
+		}
+		target := "/" + post.Link
+		source := out.source(path.Join(out.path, post.Link))
+		for _, alias := range post.Metadata.Aliases {
+			urlPath, file := aliasPath(prefix, post.Link, alias)
+			if out.exists(path.Join(out.path, file)) {
+				warnf("%s: alias %s conflicts with an existing file, skipping it", post.Link, alias)
+				continue
+			}
+			r := redirect{From: urlPath, To: target, file: file, page: post, source: source}
+			if err := renderAliasStub(out, siteConf, tmpl, r); err != nil {
+				return nil, fmt.Errorf("%s: alias %s: %w", post.Link, alias, err)
+			}
+			redirects = append(redirects, r)
+		}
+	}
+	return redirects, nil
+}
+
+// renderAliasStub writes the stub page of an alias.
+func renderAliasStub(out *outputDir, siteConf SiteConfig, tmpl *template.Template, r redirect) error {
+	buf := bytes.Buffer{}
+	if err := tmpl.Execute(&buf, map[string]interface{}{
+		"Alias": r.From,
+		"Link":  r.To,
+		"Page":  r.page,
+		"Site":  siteConf.templateData(),
+	}); err != nil {
+		return templateError("", tmpl, err)
+	}
+	return out.writeFile(path.Join(out.path, r.file), r.source, tmpl.Name(), buf.Bytes())
+}
+
+// writeRedirects saves redirects to a file for Gemini servers to issue
+// real redirects with. A .toml file gets a [PermRedirects] section
+// suitable for Molly Brown configuration; any other file gets a line
+// per redirect with the alias path and the page path separated by a
+// space.
+func writeRedirects(out *outputDir, filename string, redirects []redirect) error {
+	buf := bytes.Buffer{}
+	if filepath.Ext(filename) == ".toml" {
+		perm := make(map[string]string, len(redirects))
+		for _, r := range redirects {
+			perm[mollyRedirectKey(r.From)] = r.To
+		}
+		if err := toml.NewEncoder(&buf).Encode(map[string]interface{}{
+			"PermRedirects": perm,
+		}); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range redirects {
+			fmt.Fprintf(&buf, "%s %s\n", r.From, r.To)
+		}
+	}
+	return out.writeFile(filename, "", "", buf.Bytes())
+}
+
+// mollyRedirectKey returns the [PermRedirects] key matching requests
+// for an alias path. Molly Brown matches the keys as regular expressions
+// against request paths, so the path is escaped and anchored, and the
+// trailing slash of directory aliases is made optional: /old/p1/
+// becomes ^/old/p1/?$, matching both /old/p1 and /old/p1/.
+func mollyRedirectKey(urlPath string) string {
+	return "^" + regexp.QuoteMeta(strings.TrimSuffix(urlPath, "/")) + "/?$"
+}
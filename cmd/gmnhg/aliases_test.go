@@ -0,0 +1,160 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/tdemin/gmnhg/internal/gmnhg"
+)
+
+func TestAliasPath(t *testing.T) {
+	tests := []struct {
+		prefix, pageLink, alias string
+		urlPath, file           string
+	}{
+		{"", "posts/p1.gmi", "/old/p1/", "/old/p1/", "old/p1/index.gmi"},
+		{"", "posts/p1.gmi", "/old/p1", "/old/p1/", "old/p1/index.gmi"},
+		{"", "posts/p1.gmi", "old", "/posts/old/", "posts/old/index.gmi"},
+		{"", "posts/p1.gmi", "../other/", "/other/", "other/index.gmi"},
+		{"", "posts/p1.gmi", "/a/../../b", "/b/", "b/index.gmi"},
+		{"", "posts/p1.gmi", "/old.html", "/old.gmi", "old.gmi"},
+		{"", "posts/p1.gmi", "/old/page.htm", "/old/page.gmi", "old/page.gmi"},
+		{"", "posts/p1.gmi", "/file.txt", "/file.txt", "file.txt"},
+		{"", "p1.gmi", "/", "/", "index.gmi"},
+		{"fr", "fr/posts/p1.gmi", "/old/p1/", "/fr/old/p1/", "fr/old/p1/index.gmi"},
+		{"fr", "fr/posts/p1.gmi", "/a/../../b", "/fr/b/", "fr/b/index.gmi"},
+		{"fr", "fr/posts/p1.gmi", "/old.html", "/fr/old.gmi", "fr/old.gmi"},
+		{"fr", "fr/posts/p1.gmi", "old", "/fr/posts/old/", "fr/posts/old/index.gmi"},
+		{"fr", "fr/p1.gmi", "/", "/fr/", "fr/index.gmi"},
+	}
+	for _, test := range tests {
+		urlPath, file := aliasPath(test.prefix, test.pageLink, test.alias)
+		if urlPath != test.urlPath || file != test.file {
+			t.Errorf("aliasPath(%q, %q, %q) = %q, %q, want %q, %q", test.prefix, test.pageLink, test.alias,
+				urlPath, file, test.urlPath, test.file)
+		}
+	}
+}
+
+func TestMollyRedirectKey(t *testing.T) {
+	tests := []struct {
+		urlPath  string
+		want     string
+		match    []string
+		notMatch []string
+	}{
+		{"/old/p1/", `^/old/p1/?$`, []string{"/old/p1", "/old/p1/"}, []string{"/old/p10", "/x/old/p1/", "/old/p1/x"}},
+		{"/a+b.gmi", `^/a\+b\.gmi/?$`, []string{"/a+b.gmi"}, []string{"/aab.gmi", "/a+bxgmi"}},
+		{"/", `^/?$`, []string{"/", ""}, []string{"/x"}},
+	}
+	for _, test := range tests {
+		key := mollyRedirectKey(test.urlPath)
+		if key != test.want {
+			t.Errorf("mollyRedirectKey(%q) = %q, want %q", test.urlPath, key, test.want)
+			continue
+		}
+		re := regexp.MustCompile(key)
+		for _, p := range test.match {
+			if !re.MatchString(p) {
+				t.Errorf("%s doesn't match %q", key, p)
+			}
+		}
+		for _, p := range test.notMatch {
+			if re.MatchString(p) {
+				t.Errorf("%s matches %q", key, p)
+			}
+		}
+	}
+}
+
+func TestWriteRedirects(t *testing.T) {
+	dir := t.TempDir()
+	out := &outputDir{path: filepath.Join(dir, "output"), files: make(map[string]manifestEntry)}
+	redirects := []redirect{
+		{From: "/old/p1/", To: "/posts/p1.gmi"},
+		{From: "/a+b.gmi", To: "/posts/p2.gmi"},
+	}
+
+	list := filepath.Join(dir, "redirects.txt")
+	if err := writeRedirects(out, list, redirects); err != nil {
+		t.Fatalf("writeRedirects: %v", err)
+	}
+	contents, err := ioutil.ReadFile(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/old/p1/ /posts/p1.gmi\n/a+b.gmi /posts/p2.gmi\n"; string(contents) != want {
+		t.Errorf("%s: got %q, want %q", list, contents, want)
+	}
+
+	molly := filepath.Join(dir, "redirects.toml")
+	if err := writeRedirects(out, molly, redirects); err != nil {
+		t.Fatalf("writeRedirects: %v", err)
+	}
+	var conf struct {
+		PermRedirects map[string]string
+	}
+	if _, err := toml.DecodeFile(molly, &conf); err != nil {
+		t.Fatalf("%s: %v", molly, err)
+	}
+	want := map[string]string{
+		`^/old/p1/?$`:    "/posts/p1.gmi",
+		`^/a\+b\.gmi/?$`: "/posts/p2.gmi",
+	}
+	if !reflect.DeepEqual(conf.PermRedirects, want) {
+		t.Errorf("%s: got %v, want %v", molly, conf.PermRedirects, want)
+	}
+
+	for _, p := range []string{list, molly} {
+		if !out.exists(p) {
+			t.Errorf("%s is not recorded as written", p)
+		}
+	}
+}
+
+func TestRenderAliases(t *testing.T) {
+	dir := t.TempDir()
+	out, err := prepareOutputDir(filepath.Join(dir, "output"), false, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := filepath.Join(out.path, "posts", "p1.gmi")
+	if err := out.writeFile(page, "content/posts/p1.md", "_default/single", []byte("# P1\n")); err != nil {
+		t.Fatal(err)
+	}
+	posts := gmnhg.Posts{
+		{Link: "posts/p1.gmi", Metadata: gmnhg.Metadata{Aliases: []string{"/old/p1/"}}},
+		{Link: "posts/unrendered.gmi", Metadata: gmnhg.Metadata{Aliases: []string{"/old/unrendered/"}}},
+	}
+	redirects, err := renderAliases(out, "", SiteConfig{}, defaultAliasTemplate, posts)
+	if err != nil {
+		t.Fatalf("renderAliases: %v", err)
+	}
+	if len(redirects) != 1 || redirects[0].From != "/old/p1/" || redirects[0].To != "/posts/p1.gmi" {
+		t.Fatalf("got redirects %+v, want a single one from /old/p1/ to /posts/p1.gmi", redirects)
+	}
+	entry := out.files[filepath.Join(out.path, "old", "p1", indexFilename)]
+	if entry.Source != "content/posts/p1.md" || entry.Template != "alias" {
+		t.Errorf("alias stub recorded with source %q and template %q, want %q and %q",
+			entry.Source, entry.Template, "content/posts/p1.md", "alias")
+	}
+}
@@ -0,0 +1,123 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/tdemin/gmnhg/internal/gmnhg"
+)
+
+// buildError reports a file that failed to render.
+type buildError struct {
+	// Source is the content, template, or config file the error
+	// happened in, if any.
+	Source string
+	// Template is the name of the template that failed, if any.
+	Template string
+	// Line is the line number in Source, or zero if unknown.
+	Line int
+	Err  error
+}
+
+func (e *buildError) Error() string {
+	var b strings.Builder
+	if e.Source != "" {
+		b.WriteString(e.Source)
+		if e.Line > 0 {
+			fmt.Fprintf(&b, ":%d", e.Line)
+		}
+		b.WriteString(": ")
+	}
+	msg := e.Err.Error()
+	// template errors mention the template name themselves
+	if e.Template != "" && !strings.HasPrefix(msg, "template: ") {
+		fmt.Fprintf(&b, "template %s: ", e.Template)
+	}
+	b.WriteString(msg)
+	return b.String()
+}
+
+func (e *buildError) Unwrap() error {
+	return e.Err
+}
+
+// matches template parse errors like "template: single:3: ..."
+var templateLineRegex = regexp.MustCompile(`^template: [^:]+:(\d+):`)
+
+// templateError annotates an error of executing tmpl for a page
+// rendered from source.
+func templateError(source string, tmpl *template.Template, err error) error {
+	name := tmpl.Name()
+	var execErr template.ExecError
+	if errors.As(err, &execErr) {
+		name = execErr.Name
+	}
+	return &buildError{Source: source, Template: name, Err: err}
+}
+
+// frontMatterError annotates an error of parsing front matter of a
+// content file.
+func frontMatterError(source string, err error) error {
+	e := &buildError{Source: source, Err: err}
+	var fmErr *gmnhg.FrontMatterError
+	if errors.As(err, &fmErr) {
+		// the line goes next to the file name instead
+		withoutLine := *fmErr
+		withoutLine.Line = 0
+		e.Line, e.Err = fmErr.Line, &withoutLine
+	}
+	return e
+}
+
+// templateParseError annotates an error of parsing a template file.
+func templateParseError(source, name string, err error) error {
+	e := &buildError{Source: source, Template: name, Err: err}
+	if m := templateLineRegex.FindStringSubmatch(err.Error()); m != nil {
+		e.Line, _ = strconv.Atoi(m[1])
+	}
+	return e
+}
+
+// errorList holds errors of every file that failed to render.
+type errorList []error
+
+func (e errorList) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// reportErrors prints every error err holds to stderr, returning the
+// number of errors.
+func reportErrors(err error) int {
+	list, ok := err.(errorList)
+	if !ok {
+		list = errorList{err}
+	}
+	for _, err := range list {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+	return len(list)
+}
@@ -0,0 +1,96 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestErrorList(t *testing.T) {
+	tests := []struct {
+		name string
+		errs errorList
+		want string
+	}{
+		{"single error", errorList{errors.New("a")}, "a"},
+		{"several errors", errorList{errors.New("a"), errors.New("b"), errors.New("c")}, "a\nb\nc"},
+		{"build errors", errorList{
+			&buildError{Source: "content/a.md", Line: 2, Err: errors.New("bad key")},
+			&buildError{Source: "gmnhg/single.gotmpl", Template: "single", Err: errors.New("no such partial")},
+		}, "content/a.md:2: bad key\ngmnhg/single.gotmpl: template single: no such partial"},
+	}
+	for _, test := range tests {
+		if got := test.errs.Error(); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTemplateParseError(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     string
+	}{
+		{"first line", "{{ end }}", "gmnhg/_default/single.gotmpl:1: template: single:1: unexpected {{end}}"},
+		{"later line", "# {{ .Metadata.Title }}\n\n{{ if }}\n", "gmnhg/_default/single.gotmpl:3: template: single:3: missing value for if"},
+	}
+	for _, test := range tests {
+		_, err := template.New("single").Parse(test.contents)
+		if err == nil {
+			t.Errorf("%s: parsed with no error", test.name)
+			continue
+		}
+		if got := templateParseError("gmnhg/_default/single.gotmpl", "single", err).Error(); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestKeepGoing(t *testing.T) {
+	files := make(map[string]string)
+	for name, contents := range testSite {
+		files[name] = contents
+	}
+	files["content/posts/broken.md"] = "---\ntitle: [\n---\nBroken.\n"
+	files["gmnhg/notes/single.gotmpl"] = "{{ fail \"broken\" }}"
+	dir := chdirSite(t, files)
+	s, err := buildSite(buildOptions{outputDir: "output", jobs: 1, keepGoing: true})
+	if s == nil {
+		t.Fatalf("got no site, want one with errors: %v", err)
+	}
+	list, ok := err.(errorList)
+	if !ok || len(list) != 2 {
+		t.Fatalf("got %#v, want 2 errors", err)
+	}
+	for _, source := range []string{"content/notes/n1.md", "content/posts/broken.md"} {
+		if !strings.Contains(list.Error(), source+":") {
+			t.Errorf("got %q, want an error about %s", list.Error(), source)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "output", "posts", "p1.gmi")); err != nil {
+		t.Errorf("posts/p1.gmi: %v", err)
+	}
+	// without -keep-going, the build stops at the first error
+	if s, err := buildSite(buildOptions{outputDir: "output", jobs: 1}); s != nil || err == nil {
+		t.Errorf("got site %v and error %v without -keep-going, want only an error", s, err)
+	}
+}
@@ -0,0 +1,294 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/tdemin/gmnhg/internal/gmnhg"
+)
+
+// Hugo uses English unless told otherwise
+const defaultLanguage = "en"
+
+// LanguageConfig is an entry of the Hugo languages config section.
+type LanguageConfig struct {
+	LanguageCode string `yaml:"languageCode"`
+	LanguageName string `yaml:"languageName"`
+	Title        string `yaml:"title"`
+	Weight       int    `yaml:"weight"`
+	ContentDir   string `yaml:"contentDir"`
+}
+
+// language is a language the site is rendered in. Sites with no
+// languages configured have a single one.
+type language struct {
+	key, code, name, title string
+	weight                 int
+	isDefault              bool
+	// dir content files are read from, with a trailing slash
+	contentDir string
+	// output subdir, empty for the default language unless
+	// defaultContentLanguageInSubdir is set
+	prefix string
+}
+
+// languages returns the languages of the site sorted by weight.
+func (c SiteConfig) languages() ([]*language, error) {
+	defaultKey := strings.ToLower(c.DefaultContentLanguage)
+	if defaultKey == "" {
+		defaultKey = defaultLanguage
+	}
+	if len(c.Languages) == 0 {
+		return []*language{{
+			key:        defaultKey,
+			code:       c.LanguageCode,
+			title:      c.Title,
+			isDefault:  true,
+			contentDir: contentBase,
+		}}, nil
+	}
+	var (
+		languages  []*language
+		hasDefault bool
+	)
+	for key, lc := range c.Languages {
+		lang := &language{
+			key:        strings.ToLower(key),
+			code:       lc.LanguageCode,
+			name:       lc.LanguageName,
+			title:      lc.Title,
+			weight:     lc.Weight,
+			contentDir: contentBase,
+		}
+		lang.isDefault = lang.key == defaultKey
+		hasDefault = hasDefault || lang.isDefault
+		if lang.code == "" {
+			lang.code = lang.key
+			if lang.isDefault && c.LanguageCode != "" {
+				lang.code = c.LanguageCode
+			}
+		}
+		if lang.title == "" {
+			lang.title = c.Title
+		}
+		if lc.ContentDir != "" {
+			lang.contentDir = path.Clean(lc.ContentDir) + "/"
+		}
+		if !lang.isDefault || c.DefaultContentLanguageInSubdir {
+			lang.prefix = lang.key
+		}
+		languages = append(languages, lang)
+	}
+	if !hasDefault {
+		return nil, fmt.Errorf("defaultContentLanguage %q is not among the configured languages", defaultKey)
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		if languages[i].weight != languages[j].weight {
+			return languages[i].weight < languages[j].weight
+		}
+		return languages[i].key < languages[j].key
+	})
+	return languages, nil
+}
+
+// isMultilingual tells whether the site has languages configured.
+func (s *site) isMultilingual() bool {
+	return len(s.conf.Languages) > 0
+}
+
+// language returns the language with the key, or nil if there's none.
+func (s *site) language(key string) *language {
+	for _, lang := range s.languages {
+		if lang.key == key {
+			return lang
+		}
+	}
+	return nil
+}
+
+// owner returns the language unsuffixed content files in contentPath
+// belong to: the one with the deepest content dir holding it, the
+// default language taking precedence. It returns nil if no language
+// reads files from there.
+func (s *site) owner(contentPath string) *language {
+	var owner *language
+	for _, lang := range s.languages {
+		if !strings.HasPrefix(contentPath, lang.contentDir) {
+			continue
+		}
+		switch {
+		case owner == nil, len(lang.contentDir) > len(owner.contentDir):
+			owner = lang
+		case len(lang.contentDir) == len(owner.contentDir) && lang.isDefault:
+			owner = lang
+		}
+	}
+	return owner
+}
+
+// languageOf returns the language of a content file, along with its
+// path relative to the language content dir with the language suffix
+// removed, which is shared by all translations of a page; e.g.
+// content/posts/foo.fr.md becomes posts/foo.md in French. lang is nil
+// if the file belongs to no language.
+func (s *site) languageOf(contentPath string) (lang *language, translationPath string) {
+	owner := s.owner(contentPath)
+	if owner == nil {
+		return nil, ""
+	}
+	rel := strings.TrimPrefix(contentPath, owner.contentDir)
+	if !s.isMultilingual() {
+		return owner, rel
+	}
+	ext := path.Ext(rel)
+	base := strings.TrimSuffix(rel, ext)
+	if suffix := path.Ext(base); suffix != "" {
+		if lang := s.language(strings.ToLower(suffix[1:])); lang != nil {
+			return lang, strings.TrimSuffix(base, suffix) + ext
+		}
+	}
+	return owner, rel
+}
+
+// virtualPath returns the path a content file would have if every
+// language other than the default one had its own subdir in content/,
+// which mirrors the output dir layout.
+func (lang *language) virtualPath(translationPath string) string {
+	return path.Join(contentBase, lang.prefix, translationPath)
+}
+
+// outputPath returns the path of a file or dir in the output subdir of
+// the language, with a leading slash.
+func (lang *language) outputPath(p string) string {
+	return path.Join("/", lang.prefix, p)
+}
+
+// splitDirname returns the language of an output dirname, and the
+// dirname relative to the language output subdir.
+func (s *site) splitDirname(dirname string) (*language, string) {
+	var fallback *language
+	for _, lang := range s.languages {
+		if lang.prefix == "" {
+			fallback = lang
+			continue
+		}
+		root := "/" + lang.prefix
+		if dirname == root {
+			return lang, "/"
+		}
+		if strings.HasPrefix(dirname, root+"/") {
+			return lang, strings.TrimPrefix(dirname, root)
+		}
+	}
+	if fallback == nil {
+		// every language has a subdir
+		fallback = s.languages[0]
+	}
+	return fallback, dirname
+}
+
+// languageConf returns the site config as seen by templates rendering
+// pages in lang.
+func (s *site) languageConf(lang *language) SiteConfig {
+	conf := s.conf
+	conf.Title = lang.title
+	conf.LanguageCode = lang.code
+	return conf
+}
+
+// findIndexMd returns the _index.md file of a content subdir in lang,
+// or an empty string if there's none. Suffixed files, like _index.fr.md,
+// are preferred to unsuffixed ones.
+func (s *site) findIndexMd(lang *language, dir string) string {
+	basepath := path.Join(lang.contentDir, dir)
+	var names []string
+	if s.isMultilingual() {
+		for _, filename := range []string{geminiIndexMdFilename, hugoIndexMdFilename} {
+			names = append(names, strings.TrimSuffix(filename, ".md")+"."+lang.key+".md")
+		}
+	}
+	if s.owner(basepath+"/") == lang {
+		names = append(names, geminiIndexMdFilename, hugoIndexMdFilename)
+	}
+	for _, name := range names {
+		p := path.Join(basepath, name)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			return p
+		}
+	}
+	return ""
+}
+
+// resourcePaths returns output paths a page resource in the content dir
+// is copied to, relative to the output dir. Bundles in content dirs
+// shared by several languages get a copy for every one of them.
+func (s *site) resourcePaths(contentPath string) []string {
+	owner := s.owner(contentPath)
+	if owner == nil {
+		return []string{strings.TrimPrefix(contentPath, contentBase)}
+	}
+	rel := strings.TrimPrefix(contentPath, owner.contentDir)
+	var paths []string
+	for _, lang := range s.languages {
+		if lang.contentDir == owner.contentDir {
+			paths = append(paths, path.Join(lang.prefix, rel))
+		}
+	}
+	return paths
+}
+
+// linkTranslations sets translations of every page: pages with the same
+// path in other languages.
+func (s *site) linkTranslations() {
+	if !s.isMultilingual() {
+		return
+	}
+	byPath := make(map[string][]string)
+	for _, src := range s.sources {
+		byPath[src.translationPath] = append(byPath[src.translationPath], src.key)
+	}
+	for _, src := range s.sources {
+		post := s.posts[src.key]
+		post.Translations = nil
+		for _, lang := range s.languages {
+			for _, key := range byPath[src.translationPath] {
+				translation := s.posts[key]
+				if key != src.key && translation.Language == lang.key {
+					translation.Translations = nil
+					post.Translations = append(post.Translations, translation)
+				}
+			}
+		}
+		s.posts[src.key] = post
+	}
+}
+
+// allPosts returns posts in lang, or posts in all languages if lang is
+// nil, in the content dir walk order.
+func (s *site) allPosts(lang *language) gmnhg.Posts {
+	posts := make(gmnhg.Posts, 0, len(s.sources))
+	for _, src := range s.sources {
+		if lang == nil || src.lang == lang {
+			posts = append(posts, s.posts[src.key])
+		}
+	}
+	return posts
+}
@@ -0,0 +1,188 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tdemin/gmnhg/internal/gmnhg"
+)
+
+// testLanguages is a config with English by default, French, and German
+// read from its own content dir.
+var testLanguages = map[string]LanguageConfig{
+	"en": {Weight: 1},
+	"fr": {Weight: 2},
+	"de": {Weight: 3, ContentDir: "content/de"},
+}
+
+// newLanguageSite returns a site with the languages of conf.
+func newLanguageSite(t *testing.T, conf SiteConfig) *site {
+	t.Helper()
+	languages, err := conf.languages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &site{conf: conf, languages: languages}
+}
+
+func TestLanguages(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     SiteConfig
+		prefixes map[string]string
+	}{
+		{"no languages", SiteConfig{}, map[string]string{"en": ""}},
+		{"default language", SiteConfig{Languages: testLanguages}, map[string]string{"en": "", "fr": "fr", "de": "de"}},
+		{"default language in subdir", SiteConfig{Languages: testLanguages, DefaultContentLanguageInSubdir: true}, map[string]string{"en": "en", "fr": "fr", "de": "de"}},
+		{"other default language", SiteConfig{Languages: testLanguages, DefaultContentLanguage: "fr"}, map[string]string{"en": "en", "fr": "", "de": "de"}},
+	}
+	for _, test := range tests {
+		s := newLanguageSite(t, test.conf)
+		prefixes := make(map[string]string)
+		for _, lang := range s.languages {
+			prefixes[lang.key] = lang.prefix
+		}
+		if !reflect.DeepEqual(prefixes, test.prefixes) {
+			t.Errorf("%s: got prefixes %v, want %v", test.name, prefixes, test.prefixes)
+		}
+	}
+	if _, err := (SiteConfig{Languages: testLanguages, DefaultContentLanguage: "es"}).languages(); err == nil {
+		t.Errorf("got no error for a default language that is not configured")
+	}
+}
+
+func TestLanguageOf(t *testing.T) {
+	multilingual := newLanguageSite(t, SiteConfig{Languages: testLanguages})
+	monolingual := newLanguageSite(t, SiteConfig{})
+	tests := []struct {
+		name            string
+		s               *site
+		contentPath     string
+		lang            string
+		translationPath string
+	}{
+		{"default language", multilingual, "content/posts/foo.md", "en", "posts/foo.md"},
+		{"language suffix", multilingual, "content/posts/foo.fr.md", "fr", "posts/foo.md"},
+		{"uppercase suffix", multilingual, "content/posts/foo.FR.md", "fr", "posts/foo.md"},
+		{"suffixed index", multilingual, "content/posts/_index.fr.md", "fr", "posts/_index.md"},
+		{"unknown suffix", multilingual, "content/posts/foo.es.md", "en", "posts/foo.es.md"},
+		{"language content dir", multilingual, "content/de/posts/foo.md", "de", "posts/foo.md"},
+		{"suffix in language content dir", multilingual, "content/de/posts/foo.fr.md", "fr", "posts/foo.md"},
+		{"no languages", monolingual, "content/posts/foo.fr.md", "en", "posts/foo.fr.md"},
+		{"outside of content", multilingual, "static/foo.md", "", ""},
+	}
+	for _, test := range tests {
+		lang, translationPath := test.s.languageOf(test.contentPath)
+		key := ""
+		if lang != nil {
+			key = lang.key
+		}
+		if key != test.lang || translationPath != test.translationPath {
+			t.Errorf("%s: got %q, %q, want %q, %q", test.name, key, translationPath, test.lang, test.translationPath)
+		}
+	}
+}
+
+func TestSplitDirname(t *testing.T) {
+	s := newLanguageSite(t, SiteConfig{Languages: testLanguages})
+	inSubdir := newLanguageSite(t, SiteConfig{Languages: testLanguages, DefaultContentLanguageInSubdir: true})
+	tests := []struct {
+		name     string
+		s        *site
+		dirname  string
+		lang     string
+		relative string
+	}{
+		{"root", s, "/", "en", "/"},
+		{"default language", s, "/posts", "en", "/posts"},
+		{"language root", s, "/fr", "fr", "/"},
+		{"language subdir", s, "/fr/posts", "fr", "/posts"},
+		{"prefix of a dirname", s, "/french", "en", "/french"},
+		{"default language in subdir", inSubdir, "/en/posts", "en", "/posts"},
+		{"root with every language in subdir", inSubdir, "/", "en", "/"},
+	}
+	for _, test := range tests {
+		lang, relative := test.s.splitDirname(test.dirname)
+		if lang.key != test.lang || relative != test.relative {
+			t.Errorf("%s: got %q, %q, want %q, %q", test.name, lang.key, relative, test.lang, test.relative)
+		}
+	}
+}
+
+func TestFindIndexMd(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"content/posts/_index.md":         "",
+		"content/posts/_index.fr.md":      "",
+		"content/notes/_index.md":         "",
+		"content/gemini/_index.gmi.md":    "",
+		"content/gemini/_index.md":        "",
+		"content/gemini/_index.gmi.fr.md": "",
+		"content/de/posts/_index.md":      "",
+	})
+	s := newLanguageSite(t, SiteConfig{Languages: testLanguages})
+	tests := []struct {
+		lang, dir string
+		want      string
+	}{
+		{"en", "posts", "content/posts/_index.md"},
+		{"fr", "posts", "content/posts/_index.fr.md"},
+		{"fr", "notes", ""},
+		{"en", "gemini", "content/gemini/_index.gmi.md"},
+		{"fr", "gemini", "content/gemini/_index.gmi.fr.md"},
+		{"de", "posts", "content/de/posts/_index.md"},
+		{"en", "missing", ""},
+	}
+	for _, test := range tests {
+		if got := s.findIndexMd(s.language(test.lang), test.dir); got != test.want {
+			t.Errorf("findIndexMd(%s, %q) = %q, want %q", test.lang, test.dir, got, test.want)
+		}
+	}
+}
+
+func TestLinkTranslations(t *testing.T) {
+	s := newLanguageSite(t, SiteConfig{Languages: testLanguages})
+	s.posts = make(map[string]gmnhg.Post)
+	// sources are in the walk order, which has nothing to do with weights
+	for _, key := range []string{"content/de/posts/a.md", "content/posts/a.fr.md", "content/posts/a.md", "content/posts/b.md"} {
+		lang, translationPath := s.languageOf(key)
+		s.sources = append(s.sources, source{path: key, key: key, lang: lang, translationPath: translationPath})
+		s.posts[key] = gmnhg.Post{Link: key, Language: lang.key}
+	}
+	s.linkTranslations()
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"content/posts/a.md", []string{"fr", "de"}},
+		{"content/posts/a.fr.md", []string{"en", "de"}},
+		{"content/de/posts/a.md", []string{"en", "fr"}},
+		{"content/posts/b.md", nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, translation := range s.posts[test.key].Translations {
+			got = append(got, translation.Language)
+			if len(translation.Translations) != 0 {
+				t.Errorf("%s: translation %s has translations of its own", test.key, translation.Language)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got translations %v, want %v", test.key, got, test.want)
+		}
+	}
+}
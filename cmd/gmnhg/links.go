@@ -0,0 +1,146 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// linkRewriter maps links between Hugo content pages to the Gemtext
+// files gmnhg renders them to.
+type linkRewriter struct {
+	// output files by content paths relative to the content dir
+	pages map[string]string
+	// output files by Hugo page URLs, e.g. posts/foo/
+	urls map[string]string
+	// absolute links are produced if set
+	baseURL *url.URL
+}
+
+// newLinkRewriter creates a linkRewriter producing absolute links with
+// baseURL, or relative links if baseURL is empty.
+func newLinkRewriter(baseURL string) (*linkRewriter, error) {
+	l := &linkRewriter{
+		pages: make(map[string]string),
+		urls:  make(map[string]string),
+	}
+	if baseURL != "" {
+		u, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/")
+		if err != nil {
+			return nil, err
+		}
+		l.baseURL = u
+	}
+	return l, nil
+}
+
+// hugoURL returns the URL path Hugo would give a content file, without
+// the leading slash; posts/foo.md, posts/foo/index.md, and
+// posts/foo/_index.md all become posts/foo/.
+func hugoURL(contentPath string) string {
+	dir, file := path.Split(contentPath)
+	switch file {
+	case hugoIndexMdFilename, geminiIndexMdFilename, "index.md":
+		return dir
+	}
+	return strings.TrimSuffix(contentPath, ".md") + "/"
+}
+
+// addPage registers a content file rendered to output, both paths
+// being relative to the content and output dirs respectively.
+func (l *linkRewriter) addPage(contentPath, output string) {
+	l.pages[contentPath] = output
+	l.urls[hugoURL(contentPath)] = output
+}
+
+// addURL registers the Hugo page URL of a content file whose URL does
+// not follow from its path, such as a translation of a page.
+func (l *linkRewriter) addURL(contentPath, output string) {
+	l.urls[hugoURL(contentPath)] = output
+}
+
+// forPage returns a function rewriting links found on a page at
+// contentPath.
+func (l *linkRewriter) forPage(contentPath string) func(string) string {
+	output, ok := l.pages[contentPath]
+	if !ok {
+		output = strings.TrimSuffix(contentPath, ".md") + ".gmi"
+	}
+	return l.forOutput(contentPath, output)
+}
+
+// forOutput returns a function rewriting links found on a page at
+// contentPath rendered to output, such as a page of a paginated index.
+func (l *linkRewriter) forOutput(contentPath, output string) func(string) string {
+	return func(destination string) string {
+		return l.rewrite(contentPath, output, destination)
+	}
+}
+
+func (l *linkRewriter) rewrite(contentPath, output, destination string) string {
+	uri, err := url.Parse(destination)
+	if err != nil || uri.Scheme != "" || uri.Host != "" || uri.Path == "" {
+		return destination
+	}
+	isAbs := path.IsAbs(uri.Path)
+	var target string
+	if strings.HasSuffix(uri.Path, ".md") {
+		// Markdown files are linked relative to the file itself
+		p := path.Join(path.Dir(contentPath), uri.Path)
+		if isAbs {
+			p = strings.TrimPrefix(path.Clean(uri.Path), "/")
+		}
+		if t, ok := l.pages[p]; ok {
+			target = t
+		} else {
+			target = strings.TrimSuffix(p, ".md") + ".gmi"
+		}
+	} else if path.Ext(uri.Path) == "" {
+		// pretty URLs are relative to the page URL, like in browsers
+		p := path.Join(hugoURL(contentPath), uri.Path)
+		if isAbs {
+			p = path.Clean(uri.Path)
+		}
+		p = strings.Trim(p, "/") + "/"
+		if p == "/" {
+			p = ""
+		}
+		t, ok := l.urls[p]
+		if !ok {
+			return destination
+		}
+		target = t
+	} else {
+		return destination
+	}
+	switch {
+	case l.baseURL != nil:
+		uri.Path = target
+		return l.baseURL.ResolveReference(uri).String()
+	case isAbs:
+		uri.Path = "/" + target
+	default:
+		rel, err := filepath.Rel(path.Dir(output), target)
+		if err != nil {
+			return destination
+		}
+		uri.Path = filepath.ToSlash(rel)
+	}
+	return uri.String()
+}
@@ -0,0 +1,86 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import "testing"
+
+func TestLinkRewriter(t *testing.T) {
+	relative, err := newLinkRewriter("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	absolute, err := newLinkRewriter("gemini://example.com/blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []*linkRewriter{relative, absolute} {
+		l.addPage("_index.md", "index.gmi")
+		l.addPage("about.md", "about.gmi")
+		l.addPage("posts/_index.md", "posts/index.gmi")
+		l.addPage("posts/first.md", "posts/first.gmi")
+		l.addPage("posts/second/index.md", "posts/second/index.gmi")
+	}
+	tests := []struct {
+		name        string
+		rewriter    *linkRewriter
+		contentPath string
+		output      string
+		destination string
+		want        string
+	}{
+		{"markdown file", relative, "posts/first.md", "posts/first.gmi", "second/index.md", "second/index.gmi"},
+		{"markdown file up", relative, "posts/first.md", "posts/first.gmi", "../about.md", "../about.gmi"},
+		{"markdown file absolute", relative, "posts/first.md", "posts/first.gmi", "/about.md", "/about.gmi"},
+		{"unknown markdown file", relative, "posts/first.md", "posts/first.gmi", "missing.md", "missing.gmi"},
+		{"fragment", relative, "posts/first.md", "posts/first.gmi", "../about.md#section", "../about.gmi#section"},
+		{"pretty URL", relative, "posts/first.md", "posts/first.gmi", "../second/", "second/index.gmi"},
+		{"pretty URL absolute", relative, "posts/first.md", "posts/first.gmi", "/about/", "/about.gmi"},
+		{"pretty URL of a section", relative, "about.md", "about.gmi", "/posts/", "/posts/index.gmi"},
+		{"site root", relative, "posts/first.md", "posts/first.gmi", "/", "/index.gmi"},
+		{"unknown pretty URL", relative, "posts/first.md", "posts/first.gmi", "/unknown/", "/unknown/"},
+		{"paginated index", relative, "posts/_index.md", "posts/page/2/index.gmi", "first.md", "../../first.gmi"},
+		{"other file", relative, "posts/first.md", "posts/first.gmi", "image.png", "image.png"},
+		{"anchor only", relative, "posts/first.md", "posts/first.gmi", "#top", "#top"},
+		{"other host", relative, "posts/first.md", "posts/first.gmi", "https://example.com/a.md", "https://example.com/a.md"},
+		{"other scheme", relative, "posts/first.md", "posts/first.gmi", "mailto:me@example.com", "mailto:me@example.com"},
+		{"base URL", absolute, "posts/first.md", "posts/first.gmi", "../about.md", "gemini://example.com/blog/about.gmi"},
+		{"base URL pretty URL", absolute, "posts/first.md", "posts/first.gmi", "/posts/second/", "gemini://example.com/blog/posts/second/index.gmi"},
+	}
+	for _, test := range tests {
+		if got := test.rewriter.rewrite(test.contentPath, test.output, test.destination); got != test.want {
+			t.Errorf("%s: rewrite(%q, %q, %q) = %q, want %q", test.name,
+				test.contentPath, test.output, test.destination, got, test.want)
+		}
+	}
+}
+
+func TestHugoURL(t *testing.T) {
+	tests := []struct {
+		contentPath string
+		want        string
+	}{
+		{"posts/foo.md", "posts/foo/"},
+		{"posts/foo/index.md", "posts/foo/"},
+		{"posts/foo/_index.md", "posts/foo/"},
+		{"posts/_index.gmi.md", "posts/"},
+		{"_index.md", ""},
+	}
+	for _, test := range tests {
+		if got := hugoURL(test.contentPath); got != test.want {
+			t.Errorf("hugoURL(%q) = %q, want %q", test.contentPath, got, test.want)
+		}
+	}
+}
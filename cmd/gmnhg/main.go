@@ -21,24 +21,105 @@
 // then apply them to content files ending with .md by the following
 // algorithm (layout file names are relative to gmnhg/):
 //
-// 1. If the .md file specifies its own layout, the relevant layout file
-// is applied. If not, the default template is applied (single). If the
-// layout file does not exist, the file is skipped. Draft posts are not
-// rendered.
+// 1. Pages are rendered with the first template found out of
+// {section}/single, {type}/single, _default/single, and single, where
+// the section is the top-level content directory of the page, and the
+// type is set with the "type" front matter key, defaulting to the
+// section. The built-in template is used if there's none of these. A
+// page specifying its own layout is rendered with {section}/{layout},
+// {type}/{layout}, _default/{layout}, or {layout}; if none of these
+// exist, the page is skipped. Draft posts, posts with publishDate (or
+// date) in the future, and posts with expiryDate in the past are not
+// rendered, unless -buildDrafts, -buildFuture, or -buildExpired are
+// given respectively.
 //
-// 2. For every top-level content directory an index.gmi is generated,
-// the corresponding template is taken from top/{directory_name}.gotmpl.
-// Its content is taken from either _index.gmi.md or _index.md (.gmi.md
-// preferred) in that dir. If there's no matching template or no
-// _index.gmi.md / _index.md, the index won't be rendered.
+// 2. For every content directory with pages, other than leaf bundles,
+// an index.gmi is generated from its _index.gmi.md or _index.md
+// (.gmi.md preferred) with the first template found out of
+// top/{directory_name}, {section}/list, {type}/list (the type set in
+// the _index.md front matter), and _default/list. Directories with no
+// _index.md get an index with no content. If there's no matching
+// template, the index won't be rendered, and a warning is printed.
 //
-// Templates for subdirectories are placed in subfolders under top/. For
-// example, a template for an index at series/first/_index.gmi.md should
-// be placed at top/series/first.gotmpl.
+// top/ templates for subdirectories are placed in subfolders under
+// top/. For example, a template for an index at
+// series/first/_index.gmi.md would be placed at top/series/first.gotmpl,
+// while series/list.gotmpl would render indexes of all directories in
+// series/.
 //
 // 3. The very top index.gmi is generated from index.gotmpl and
 // top-level _index.gmi.
 //
+// Templates in partials/ can be included in any other template, e.g.
+// {{ template "partials/footer" . }} renders partials/footer.gotmpl.
+// A template consisting of definitions only, like
+// {{ define "main" }}...{{ end }}, is rendered with baseof.gotmpl from
+// its directory, or _default/baseof.gotmpl, the definitions replacing
+// the baseof {{ block }} actions of the same names. Templates invoking
+// undefined templates fail the build.
+//
+// Links between content files are rewritten to point to the files
+// rendered from them: a link to ../other-post.md, or to a Hugo URL like
+// /posts/other-post/, becomes a link to the corresponding .gmi file.
+// Relative links stay relative, and root-relative links stay
+// root-relative, unless "absoluteLinks" is set in the "gmnhg" config
+// section, in which case links are made absolute using gmnhg.baseUrl.
+// Rewriting can be disabled with "disableLinkRewriting".
+//
+// Hugo ref and relref shortcodes, like {{< ref "posts/foo.md" >}}, are
+// resolved to the rendered files. ref produces absolute links with
+// gmnhg.baseUrl if set, and relref produces root-relative links. Pages
+// can be referenced relative to the current page, relative to the
+// content dir, or by their file name if it's unique. A reference that
+// cannot be resolved, for instance one pointing to a draft, fails the
+// build.
+//
+// Other shortcodes are rendered with templates from shortcodes/, e.g.
+// {{< youtube abc >}} is rendered with shortcodes/youtube.gotmpl. Output
+// of shortcodes called with {{% %}} is rendered as Markdown along with
+// the rest of the page, while output of the ones called with {{< >}} is
+// inserted into the rendered Gemtext as is. Output starting with a link
+// line, a heading, or a preformatted block is put on lines of its own,
+// breaking the paragraph, list item, or quote it's called in; calling
+// such shortcodes inside headings, links, or preformatted blocks fails
+// the build. Shortcode templates are
+// passed .Name, which is the shortcode name, .Params, which is a map of
+// named parameters (or a slice of positional ones), .Inner, which is
+// the text between the opening and the closing tag, and .Page, which
+// contains .Link and .Metadata of the page. .Get returns a parameter by
+// its position or name, like in Hugo. gmnhg provides built-in figure,
+// gist, highlight, tweet, vimeo, and youtube shortcodes, rendering the
+// embedded content as Gemtext links. Shortcodes with no template are
+// stripped with a warning, leaving the text between their tags intact.
+// Shortcodes can be escaped like {{</* this */>}}.
+//
+// For every taxonomy set in the Hugo config ("taxonomies", defaulting
+// to tags and categories), a list of terms is rendered to
+// {taxonomy}/index.gmi, and a list of posts along with an RSS feed is
+// rendered to {taxonomy}/{term}/ for every term, term names being
+// urlized like in Hugo. Taxonomy lists use taxonomy/{taxonomy}.gotmpl
+// or _default/taxonomy.gotmpl, and are passed .Taxonomy, .Terms (each
+// having .Name, .Slug, .Link, and .Posts), .Dirname, .Link, and .Site.
+// Term pages use term/{taxonomy}.gotmpl or _default/term.gotmpl, and
+// are passed .Taxonomy, .Term, .Posts, .Dirname, .Link, and .Site.
+// gmnhg falls back to built-in templates if none are defined. Post
+// terms are available to templates with .Metadata.Terms "taxonomy".
+//
+// For every alias of a page, set with the "aliases" front matter key,
+// a stub page linking to the page is rendered with alias.gotmpl, or a
+// built-in template if there's none. The template is passed .Alias,
+// which is the alias URL path, .Link, which is the root-relative link
+// to the page, .Page, which contains the page itself, and .Site.
+// Aliases without a leading slash are relative to the page directory,
+// and the other ones to the output subdir of the page language, if it
+// has one. Aliases with no extension are rendered to {alias}/index.gmi,
+// and .html extensions are replaced with .gmi. With -redirects FILE,
+// the aliases are also written to FILE for Gemini servers to issue
+// real redirects: a FILE ending with .toml gets a [PermRedirects]
+// section for Molly Brown config, keyed by anchored regular
+// expressions like "^/old/post/?$", and any other FILE gets an "alias
+// page" line per alias.
+//
 // The program will then copy static files from static/ directory to the
 // output dir. Page resources (non-Markdown files) will also be copied
 // from the content/ directory as-is, without further modification.
@@ -49,6 +130,17 @@
 // rendered, .Metadata, which contains the metadata crawled from it (see
 // Metadata in internal/gmnhg/post.go), and .Link, which contains the
 // filename relative to content dir (with .md replaced with .gmi).
+// All front matter keys, including the ones with a dedicated Metadata
+// field, are available in .Metadata.Params, keyed by their lowercased
+// names, e.g. {{ .Metadata.Params.author }}.
+//
+// Pages also have .Summary: the "summary" front matter key if set, the
+// text of content before the <!--more--> divider if there's one, or the
+// first 70 words of the page text otherwise. Summaries are plain text,
+// link lines and preformatted blocks left out; dividers in code don't
+// count. The number of words is set with "summaryLength" in the Hugo
+// config. .Truncated tells whether the page has more to it than the
+// summary. RSS feeds use summaries as item descriptions.
 //
 // 2. Directory index pages, including the top-level index, are passed
 // .Posts, which is a slice over post metadata crawled (see Metadata in
@@ -69,9 +161,41 @@
 // and leaf bundles), with the exception of leaf resource pages. This
 // allows for roll-up indices.
 //
+// Directory indices are also passed .Paginator, which holds a single
+// page of posts when "paginate" is set to the number of posts per page
+// in the "gmnhg" config section. .Paginator has .Posts on the current
+// page (newest first), .PageNumber, .TotalPages, .TotalPosts, .HasPrev,
+// .HasNext, and .First, .Last, .Prev, and .Next page links. The first
+// page is rendered to index.gmi, and the following ones to
+// page/2/index.gmi, page/3/index.gmi, and so on. Without "paginate",
+// .Paginator holds all posts on a single page. The top-level index is
+// paginated over all posts of the site, and the built-in index template
+// lists the posts of the current page, linked root-relative, along with
+// links to the previous and next pages; unpaginated, it lists posts by
+// directory with relative links. Relative links in .Content point to
+// the same files on every page.
+//
+// Lists of posts, like .Paginator.Posts, can be grouped for archives
+// with .GroupByDate "2006" (or "2006-01" for months), .GroupBySection,
+// and .GroupByParam "series", which return a list of groups holding
+// .Key and .Posts, e.g.
+// {{ range .Paginator.Posts.GroupByDate "2006" }}## {{ .Key }}{{ end }}.
+// Posts are newest first in every group. Date groups are newest first,
+// and the other ones are sorted by key. Every post has .Section, the
+// top-level content dir it's in. .Lastmod of a list of posts is the
+// newest of their lastmod (or publish, if unset) dates, which the
+// built-in RSS template uses as the feed lastBuildDate.
+//
+// An archive.gmi listing all pages grouped by year is rendered in the
+// root of the output dir (or of every language subdir) with
+// archive.gotmpl, which is passed .Posts, .Dirname, .Link, and .Site,
+// or a built-in template. A content page rendered to archive.gmi takes
+// its place, and "disableArchive" in the "gmnhg" config section turns
+// it off.
+//
 // 3. RSS templates receive the same data as directory index pages
-// (except for .Metadata), but the filename provided by .Link is rss.xml
-// instead of index.gmi.
+// (except for .Metadata and .Paginator), but the filename provided by
+// .Link is rss.xml instead of index.gmi.
 //
 // This program provides some extra template functions on top of sort:
 //
@@ -84,6 +208,28 @@
 // * sortPosts, which is an alias to sortRev preserved for backwards
 // compatilibity.
 //
+// * gmiLink url label, which returns a Gemtext link line.
+//
+// * absURL and relURL, which resolve URLs against the gmnhg base URL
+// (or the Hugo one) like the Hugo functions do.
+//
+// * markdownify, which renders a Markdown string to Gemtext.
+//
+// * truncateGemtext n text, which returns the first n lines of Gemtext
+// (such as .Post), leaving out a preformatted block that would be cut.
+//
+// * wordCount and readingTime (in minutes) of Gemtext.
+//
+// * where, which filters posts like the Hugo function, e.g.
+// where .Posts "Metadata.Params.series" "in" (list "a" "b").
+//
+// * first n list, which returns the first n posts or other list
+// elements, e.g. first 5 (sortPosts .Posts). Given a list only, it
+// returns its first element like the sprig function.
+//
+// * groupByYear, which groups posts by year into a list of .Key and
+// .Posts, newest first.
+//
 // Template functions from sprig are also available
 // (https://github.com/Masterminds/sprig); see the sprig documentation
 // for more details.
@@ -100,6 +246,25 @@
 // at least "baseUrl" unless your site uses a protocol-relative base URL
 // (beginning with a double slash instead of https://).
 //
+// The same section configures the Gemtext renderer: "clampHeadings"
+// renders headings deeper than level 3 as level 3 ones, "skipHtml"
+// drops HTML blocks instead of rendering their text, "markdownTables"
+// draws tables with Markdown-like pipe borders, and "tableColumnWidth"
+// sets the width at which table cell text gets wrapped.
+//
+// "linkPlacement" sets where links blocks go: "paragraph" (the default)
+// renders them after every paragraph or other block element, "section"
+// collects them up to the next heading, and "document" renders all of
+// them in a single "References" block at the end of the page; moved
+// links keep the order of the text, and paragraphs and lists of links
+// only stay in place.
+// "linkNumbering" marks inline links in text with [N] references that
+// are repeated in link lines; numbering either restarts with every
+// links block ("block") or runs through the entire page ("document").
+// "linkDedupe" renders links to the same destination once per links
+// block ("block"), or skips links already rendered earlier in the page
+// ("document").
+//
 // RSS templates can be overriden by defining a template in one of
 // several places:
 //
@@ -110,38 +275,96 @@
 // * Directories: gmnhg/rss/dirname.gotmpl for a directory "/dirname" or
 // gmnhg/rss/dirname/subdir.gotmpl for "/dirname/subdir"
 //
+// * Taxonomy terms: gmnhg/rss/tags.gotmpl for all terms of "tags", or
+// gmnhg/rss/tags/term.gotmpl for a single term
+//
+// Multilingual sites, with a "languages" section in the Hugo config,
+// are rendered in every language configured. A page is in the language
+// its file name is suffixed with, like posts/foo.fr.md, or in the
+// language whose "contentDir" holds it, and in "defaultContentLanguage"
+// otherwise. Languages other than the default one are rendered to their
+// own output subdirs, like fr/posts/foo.gmi, with their own indexes,
+// RSS feeds, and taxonomy pages; "defaultContentLanguageInSubdir" puts
+// the default language into its subdir as well. _index.fr.md files
+// provide index content for a language. Templates are shared by all
+// languages; pages get their language as .Language and .LanguageCode,
+// and the same page in other languages as .Translations, while .Site
+// holds the title and language code of the page language.
+//
+// Running "gmnhg serve" builds the site to a temporary directory and
+// serves it over Gemini at localhost:1965 (set with -bind) for preview,
+// using a self-signed certificate generated on startup. Links made
+// absolute with gmnhg.baseUrl point to the preview server instead. The
+// server answers with text/gemini for .gmi files, guesses MIME types of
+// other files by their extension or contents, and serves index.gmi for
+// directories.
+//
+// Pages, indexes, and feeds are rendered in parallel, -j setting the
+// number of files rendered at once (the number of CPUs by default).
+// The output does not depend on it.
+//
+// Errors are reported with the content or template file, and the line
+// if known, they happened in. Files that fail to render do not stop
+// others from being rendered; errors of all of them are reported, and
+// gmnhg exits with a non-zero status. Unless -keep-going is given, the
+// build stops after the first stage with errors, leaving the output dir
+// intact if pages fail to render to Gemtext; with -keep-going,
+// everything that can be rendered is written anyway. Front matter that
+// fails to parse is an error as well, rather than being rendered as
+// part of the page, which would publish drafts.
+//
+// The output dir is emptied before every build. gmnhg leaves a .gmnhg
+// file in it, and refuses to empty non-empty dirs without one, as they
+// might hold something other than a previous build, unless -force is
+// given. With -sync, the output dir is not emptied; instead, only files
+// whose contents change are written, and files not produced by the
+// build are removed afterwards, so that modification times of the
+// others are preserved for tools like rsync.
+//
+// With -dry-run, nothing is written to the output dir; the site is
+// rendered in memory, and files that a build would create, change, or
+// remove are printed instead. -manifest saves a JSON list of all files
+// of the build, giving their paths relative to the output dir, the
+// content or static files and templates they're made from, their sizes,
+// and SHA-256 hashes of their contents. On a dry run, the list is
+// printed after the changes rather than saved.
+//
+// With -watch, gmnhg keeps running after the build, checking content/,
+// gmnhg/, static/, and the Hugo config for changes. A modified page is
+// rendered again along with the indexes and RSS feeds of directories
+// it's in, the top-level index, and taxonomy pages, and modified static
+// files and page resources are copied again. Changes to templates or
+// the config, added or removed pages, and changes to whether a page is
+// published, its aliases, or its taxonomy terms cause the entire site
+// to be rebuilt. -watch can also be used with gmnhg serve.
+//
 // One might want to ignore _index.gmi.md files with the following Hugo
 // config option in config.toml:
 //
-//  ignoreFiles = [ "_index\\.gmi\\.md$" ]
+//	ignoreFiles = [ "_index\\.gmi\\.md$" ]
 package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"os"
 	"path"
-	"path/filepath"
 	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
-	"text/template"
-
-	"github.com/BurntSushi/toml"
-	"gopkg.in/yaml.v2"
 
 	gemini "github.com/tdemin/gmnhg"
-	"github.com/tdemin/gmnhg/internal/gmnhg"
 )
 
 const (
 	defaultPageTemplate   = "single"
+	baseofTemplate        = "baseof"
+	partialsDir           = "partials/"
 	hugoIndexMdFilename   = "_index.md"
 	geminiIndexMdFilename = "_index.gmi.md"
 	indexFilename         = "index.gmi"
+	archiveFilename       = "archive.gmi"
 	rssFilename           = "rss.xml"
 )
 
@@ -161,48 +384,89 @@ var (
 var hugoConfigFiles = []string{"config.toml", "config.yaml", "config.json"}
 
 type SiteConfig struct {
-	BaseURL      string      `yaml:"baseURL"`
-	Title        string      `yaml:"title"`
-	Copyright    string      `yaml:"copyright"`
-	LanguageCode string      `yaml:"languageCode"`
-	Gmnhg        GmnhgConfig `yaml:"gmnhg"`
-}
+	BaseURL      string            `yaml:"baseURL"`
+	Title        string            `yaml:"title"`
+	Copyright    string            `yaml:"copyright"`
+	LanguageCode string            `yaml:"languageCode"`
+	Taxonomies   map[string]string `yaml:"taxonomies"`
+	// number of words in automatic summaries
+	SummaryLength int         `yaml:"summaryLength"`
+	Gmnhg         GmnhgConfig `yaml:"gmnhg"`
 
-type GmnhgConfig struct {
-	BaseURL string `yaml:"baseURL"`
-	Title   string `yaml:"title"`
+	DefaultContentLanguage         string                    `yaml:"defaultContentLanguage"`
+	DefaultContentLanguageInSubdir bool                      `yaml:"defaultContentLanguageInSubdir"`
+	Languages                      map[string]LanguageConfig `yaml:"languages"`
 }
 
-func findIndexMd(basepath string) string {
-	for _, filename := range []string{geminiIndexMdFilename, hugoIndexMdFilename} {
-		path := path.Join(basepath, filename)
-		if info, err := os.Stat(path); err == nil && !info.IsDir() {
-			return path
-		}
+// templateData returns the .Site map passed to templates.
+func (c SiteConfig) templateData() map[string]interface{} {
+	return map[string]interface{}{
+		"BaseURL":      c.BaseURL,
+		"GmnhgBaseURL": c.Gmnhg.BaseURL,
+		"Title":        c.Title,
+		"GmnhgTitle":   c.Gmnhg.Title,
+		"Copyright":    c.Copyright,
+		"LanguageCode": c.LanguageCode,
 	}
-	return ""
 }
 
-func copyFile(dst, src string) error {
-	input, err := os.Open(src)
-	if err != nil {
-		return err
+type GmnhgConfig struct {
+	BaseURL          string `yaml:"baseURL"`
+	Title            string `yaml:"title"`
+	ClampHeadings    bool   `yaml:"clampHeadings"`
+	SkipHTML         bool   `yaml:"skipHtml"`
+	MarkdownTables   bool   `yaml:"markdownTables"`
+	TableColumnWidth int    `yaml:"tableColumnWidth"`
+	LinkPlacement    string `yaml:"linkPlacement"`
+	LinkNumbering    string `yaml:"linkNumbering"`
+	LinkDedupe       string `yaml:"linkDedupe"`
+
+	DisableLinkRewriting bool `yaml:"disableLinkRewriting"`
+	DisableArchive       bool `yaml:"disableArchive"`
+	AbsoluteLinks        bool `yaml:"absoluteLinks"`
+
+	Paginate int `yaml:"paginate"`
+}
+
+func (c GmnhgConfig) renderOptions() (gemini.Options, error) {
+	options := gemini.Options{TableColumnWidth: c.TableColumnWidth}
+	switch c.LinkPlacement {
+	case "", "paragraph":
+	case "section":
+		options.Settings |= gemini.LinksAfterSection
+	case "document":
+		options.Settings |= gemini.LinksAtEnd
+	default:
+		return options, fmt.Errorf("unknown gmnhg.linkPlacement %q; expected paragraph, section, or document", c.LinkPlacement)
 	}
-	defer input.Close()
-	if p := path.Dir(dst); p != "" {
-		if err := os.MkdirAll(p, 0755); err != nil {
-			return err
-		}
+	switch c.LinkNumbering {
+	case "", "none":
+	case "block":
+		options.Settings |= gemini.NumberLinks
+	case "document":
+		options.Settings |= gemini.NumberLinksPerDocument
+	default:
+		return options, fmt.Errorf("unknown gmnhg.linkNumbering %q; expected none, block, or document", c.LinkNumbering)
 	}
-	output, err := os.Create(dst)
-	if err != nil {
-		return err
+	switch c.LinkDedupe {
+	case "", "none":
+	case "block":
+		options.Settings |= gemini.DeduplicateLinks
+	case "document":
+		options.Settings |= gemini.DeduplicateLinksPerDocument
+	default:
+		return options, fmt.Errorf("unknown gmnhg.linkDedupe %q; expected none, block, or document", c.LinkDedupe)
 	}
-	defer output.Close()
-	if _, err := io.Copy(output, input); err != nil {
-		return err
+	if c.ClampHeadings {
+		options.Settings |= gemini.ClampHeadings
 	}
-	return nil
+	if c.SkipHTML {
+		options.Settings |= gemini.SkipHTML
+	}
+	if c.MarkdownTables {
+		options.Settings |= gemini.MarkdownTables
+	}
+	return options, nil
 }
 
 func writeFile(dst string, contents []byte) error {
@@ -222,6 +486,15 @@ func writeFile(dst string, contents []byte) error {
 	return nil
 }
 
+// pagePath returns the path of a paginated index page relative to the
+// output dir; the first page is the index itself.
+func pagePath(dirname string, page int) string {
+	if page == 1 {
+		return path.Join(dirname, indexFilename)
+	}
+	return path.Join(dirname, "page", strconv.Itoa(page), indexFilename)
+}
+
 func hasSubPath(paths []string, path string) bool {
 	for _, p := range paths {
 		if strings.HasPrefix(path, p+"/") {
@@ -231,353 +504,108 @@ func hasSubPath(paths []string, path string) bool {
 	return false
 }
 
+func warnf(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, "warning: "+format+"\n", a...)
+}
+
 var version = "v0+HEAD"
 
 func main() {
 	var (
-		outputDir, workingDir string
-		isVersionCmd          bool
+		opts         buildOptions
+		workingDir   string
+		isVersionCmd bool
+		bindAddr     string
+		watchChanges bool
 	)
-	flag.StringVar(&outputDir, "output", outputBase, "output directory (will be created if missing)")
+	flag.StringVar(&opts.outputDir, "output", outputBase, "output directory (will be created if missing)")
 	flag.StringVar(&workingDir, "working", "", "working directory (defaults to current directory)")
+	flag.BoolVar(&opts.buildDrafts, "buildDrafts", false, "include content marked as draft")
+	flag.BoolVar(&opts.buildFuture, "buildFuture", false, "include content with publishDate in the future")
+	flag.BoolVar(&opts.buildExpired, "buildExpired", false, "include expired content")
+	flag.StringVar(&opts.redirectsFile, "redirects", "", "write alias redirects to `file` (.toml for Molly Brown, plain text otherwise)")
+	flag.BoolVar(&opts.keepGoing, "keep-going", false, "render everything possible even if some files fail to")
+	flag.BoolVar(&opts.force, "force", false, "overwrite the output directory even if it was not created by gmnhg")
+	flag.BoolVar(&opts.sync, "sync", false, "only write changed files and remove stale ones instead of wiping the output directory")
+	flag.BoolVar(&opts.dryRun, "dry-run", false, "print files that would be created, changed, or removed instead of writing them")
+	flag.StringVar(&opts.manifestFile, "manifest", "", "write a JSON list of output files with their sources, templates, sizes, and hashes to `file`")
+	flag.IntVar(&opts.jobs, "j", runtime.NumCPU(), "number of files to render at once")
+	flag.StringVar(&bindAddr, "bind", defaultBindAddr, "address to serve the site at with gmnhg serve")
+	flag.BoolVar(&watchChanges, "watch", false, "watch for changes and render affected pages again")
 	flag.BoolVar(&isVersionCmd, "version", false, "display version")
-	flag.Parse()
+	// gmnhg serve [flags] previews the site with a built-in server
+	isServeCmd := len(os.Args) > 1 && os.Args[1] == "serve"
+	if isServeCmd {
+		flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+	}
 
 	if isVersionCmd {
 		println("gmnhg", version)
 		return
 	}
 
-	if workingDir != "" {
-		if err := os.Chdir(workingDir); err != nil {
-			panic(err)
-		}
-	}
-
-	configFound := false
-	var siteConf SiteConfig
-	for _, filename := range hugoConfigFiles {
-		if fileInfo, err := os.Stat(filename); !(os.IsNotExist(err) || fileInfo.IsDir()) {
-			configFound = true
-			buf, err := ioutil.ReadFile(filename)
-			if err != nil {
-				panic(err)
-			}
-			switch ext := filepath.Ext(filename); ext {
-			case ".toml":
-				if err := toml.Unmarshal(buf, &siteConf); err != nil {
-					panic(err)
-				}
-			case ".yaml":
-				if err := yaml.Unmarshal(buf, &siteConf); err != nil {
-					panic(err)
-				}
-			case ".json":
-				if err := json.Unmarshal(buf, &siteConf); err != nil {
-					panic(err)
-				}
-			}
-			break
-		}
-	}
-	if !configFound {
-		panic(fmt.Errorf("no Hugo config in %v found; not in a Hugo site dir?", hugoConfigFiles))
+	if opts.dryRun && (isServeCmd || watchChanges) {
+		exitWithErrors(fmt.Errorf("-dry-run cannot be used with -watch or gmnhg serve"))
 	}
 
-	// build templates
-	templates := make(map[string]*template.Template)
-	if _, err := os.Stat(templateBase); !os.IsNotExist(err) {
-		if err := filepath.Walk(templateBase, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			if info.IsDir() {
-				return nil
-			}
-			name := tmplNameRegex.FindStringSubmatch(path)
-			if name == nil || len(name) != 2 {
-				return nil
-			}
-			tmplName := name[1]
-			contents, err := ioutil.ReadFile(path)
-			if err != nil {
-				return err
-			}
-			tmpl, err := template.New(tmplName).Funcs(defineFuncMap()).Parse(string(contents))
-			if err != nil {
-				return err
-			}
-			templates[tmplName] = tmpl
-			return nil
-		}); err != nil {
-			panic(err)
+	if workingDir != "" {
+		if err := os.Chdir(workingDir); err != nil {
+			exitWithErrors(err)
 		}
 	}
 
-	// collect leaf node paths (directories containing an index.* file)
-	leafIndexPaths := []string{}
-	if err := filepath.Walk(contentBase, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return nil
+	if isServeCmd {
+		if err := serve(opts, bindAddr, watchChanges); err != nil {
+			exitWithErrors(err)
 		}
-		if matches := leafIndexRegex.FindStringSubmatch(path); matches != nil {
-			leafIndexPaths = append(leafIndexPaths, contentBase+matches[1])
-		}
-		return nil
-	}); err != nil {
-		panic(err)
+		return
 	}
-
-	// render posts to Gemtext and collect top level posts data
-	posts := make(map[string]gmnhg.Post)
-	topLevelPosts := make(map[string]gmnhg.Posts)
-	if err := filepath.Walk(contentBase, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if n := info.Name(); info.IsDir() || !strings.HasSuffix(n, ".md") || n == hugoIndexMdFilename || n == geminiIndexMdFilename {
-			return nil
-		}
-		fileContent, err := ioutil.ReadFile(path)
-		if err != nil {
-			return err
-		}
-		content, metadata := gmnhg.ParseMetadata(fileContent)
-		// skip drafts from rendering
-		if metadata.IsDraft {
-			return nil
-		}
-		gemText, err := gemini.RenderMarkdown(content, gemini.Defaults)
-		if err != nil {
-			return err
-		}
-		// skip headless leaves from rendering
-		isLeafIndex := info.Name() == "index.md"
-		if isLeafIndex && metadata.IsHeadless {
-			return nil
-		}
-		key := strings.TrimPrefix(strings.TrimSuffix(path, ".md"), contentBase) + ".gmi"
-		p := gmnhg.Post{
-			Post:     gemText,
-			Link:     key,
-			Metadata: metadata,
-		}
-		posts[key] = p
-		if matches := pagePathRegex.FindStringSubmatch(path); matches != nil {
-			dirs := strings.Split(matches[1], "/")
-			// only include leaf resources pages in leaf index
-			if !isLeafIndex && hasSubPath(leafIndexPaths, path) {
-				topLevelPosts["/"+matches[1]] = append(topLevelPosts["/"+matches[1]], p)
-			} else {
-				// include normal pages in all subdirectory indices
-				for i, dir := range dirs {
-					if i > 0 {
-						dirs[i] = dirs[i-1] + "/" + dir
-					}
-				}
-				for _, dir := range dirs {
-					topLevelPosts["/"+dir] = append(topLevelPosts["/"+dir], p)
-				}
-				topLevelPosts["/"] = append(topLevelPosts["/"], p)
-			}
+	s, err := buildSite(opts)
+	if err != nil {
+		if !watchChanges {
+			exitWithErrors(err)
 		}
-		return nil
-	}); err != nil {
-		panic(err)
+		reportErrors(err)
 	}
-
-	// clean up output dir beforehand
-	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
-		if err := os.MkdirAll(outputDir, 0755); err != nil {
-			panic(err)
-		}
-	} else {
-		dir, err := ioutil.ReadDir(outputDir)
-		if err != nil {
-			panic(err)
-		}
-		for _, d := range dir {
-			os.RemoveAll(path.Join(outputDir, d.Name()))
-		}
+	if watchChanges {
+		watch(s, opts)
 	}
+}
 
-	var singleTemplate = defaultSingleTemplate
-	if tmpl, hasTmpl := templates[defaultPageTemplate]; hasTmpl {
-		singleTemplate = tmpl
-	}
+// buildOptions holds command line options affecting the build.
+type buildOptions struct {
+	outputDir string
 
-	// render posts to files
-	for fileName, post := range posts {
-		var tmpl = singleTemplate
-		if pl := post.Metadata.Layout; pl != "" {
-			t, ok := templates[pl]
-			if !ok {
-				// no point trying to render pages with no layout
-				continue
-			}
-			tmpl = t
-		}
-		buf := bytes.Buffer{}
-		if err := tmpl.Execute(&buf, &post); err != nil {
-			panic(err)
-		}
-		if err := writeFile(path.Join(outputDir, fileName), buf.Bytes()); err != nil {
-			panic(err)
-		}
-	}
-	// render indexes for top-level dirs
-	for dirname, posts := range topLevelPosts {
-		// skip the main index
-		if dirname == "/" {
-			continue
-		}
-		tmpl, hasTmpl := templates["top"+dirname]
-		if !hasTmpl {
-			continue
-		}
-		fileContent, err := ioutil.ReadFile(findIndexMd(path.Join(contentBase, dirname)))
-		if err != nil {
-			// skip unreadable index files
-			continue
-		}
-		content, metadata := gmnhg.ParseMetadata(fileContent)
-		if metadata.IsDraft {
-			continue
-		}
-		gemtext, err := gemini.RenderMarkdown(content, gemini.Defaults)
-		if err != nil {
-			panic(err)
-		}
-		sc := map[string]interface{}{
-			"BaseURL":      siteConf.BaseURL,
-			"GmnhgBaseURL": siteConf.Gmnhg.BaseURL,
-			"Title":        siteConf.Title,
-			"GmnhgTitle":   siteConf.Gmnhg.Title,
-			"Copyright":    siteConf.Copyright,
-			"LanguageCode": siteConf.LanguageCode,
-		}
-		cnt := map[string]interface{}{
-			"Posts":    posts,
-			"Dirname":  dirname,
-			"Link":     path.Join(dirname, indexFilename),
-			"Content":  gemtext,
-			"Site":     sc,
-			"Metadata": metadata,
-		}
-		buf := bytes.Buffer{}
-		if err := tmpl.Execute(&buf, cnt); err != nil {
-			panic(err)
-		}
-		if err := writeFile(path.Join(outputDir, dirname, indexFilename), buf.Bytes()); err != nil {
-			panic(err)
-		}
-	}
-	// render index page
-	var indexTmpl = defaultIndexTemplate
-	if t, hasIndexTmpl := templates["index"]; hasIndexTmpl {
-		indexTmpl = t
-	}
-	indexContent, err := ioutil.ReadFile(findIndexMd(contentBase))
-	if err != nil {
-		panic(err)
-	}
-	content, metadata := gmnhg.ParseMetadata(indexContent)
-	gemtext, err := gemini.RenderMarkdown(content, gemini.Defaults)
-	if err != nil {
-		panic(err)
-	}
-	sc := map[string]interface{}{
-		"BaseURL":      siteConf.BaseURL,
-		"GmnhgBaseURL": siteConf.Gmnhg.BaseURL,
-		"Title":        siteConf.Title,
-		"GmnhgTitle":   siteConf.Gmnhg.Title,
-		"Copyright":    siteConf.Copyright,
-		"LanguageCode": siteConf.LanguageCode,
-	}
-	cnt := map[string]interface{}{
-		"Posts":    topLevelPosts,
-		"Dirname":  "/",
-		"Link":     path.Join("/", indexFilename),
-		"Content":  gemtext,
-		"Site":     sc,
-		"Metadata": metadata,
-	}
-	buf := bytes.Buffer{}
-	if err := indexTmpl.Execute(&buf, cnt); err != nil {
-		panic(err)
-	}
-	if err := writeFile(path.Join(outputDir, indexFilename), buf.Bytes()); err != nil {
-		panic(err)
-	}
+	buildDrafts, buildFuture, buildExpired bool
 
-	// render RSS/Atom feeds
-	if tmpl, hasTmpl := templates["_default/rss"]; hasTmpl {
-		defaultRssTemplate = tmpl
-	}
-	for dirname, posts := range topLevelPosts {
-		// do not render RSS for leaf paths
-		if hasSubPath(leafIndexPaths, path.Join(contentBase, dirname)+"/") {
-			continue
-		}
-		tmpl, hasTmpl := templates["rss"+dirname]
-		if !hasTmpl {
-			if rootTmpl, hasTmpl := templates["rss"]; dirname == "/" && hasTmpl {
-				tmpl = rootTmpl
-			} else {
-				tmpl = defaultRssTemplate
-			}
-		}
-		sc := map[string]interface{}{
-			"BaseURL":      siteConf.BaseURL,
-			"GmnhgBaseURL": siteConf.Gmnhg.BaseURL,
-			"Title":        siteConf.Title,
-			"GmnhgTitle":   siteConf.Gmnhg.Title,
-			"Copyright":    siteConf.Copyright,
-			"LanguageCode": siteConf.LanguageCode,
-		}
-		cnt := map[string]interface{}{
-			"Posts":   posts,
-			"Dirname": dirname,
-			"Link":    path.Join(dirname, rssFilename),
-			"Site":    sc,
-		}
-		buf := bytes.Buffer{}
-		if err := tmpl.Execute(&buf, cnt); err != nil {
-			panic(err)
-		}
-		if err := writeFile(path.Join(outputDir, dirname, rssFilename), buf.Bytes()); err != nil {
-			panic(err)
-		}
-	}
+	redirectsFile string
+	// overrides gmnhg.baseUrl from the site config if set
+	baseURL string
+	// number of files rendered at once
+	jobs int
+	// files that fail to render are skipped instead of stopping the
+	// build if set
+	keepGoing bool
+	// the output dir is overwritten even with no marker file if set
+	force bool
+	// only changed files are written, and stale files removed, instead
+	// of wiping the output dir if set
+	sync bool
+	// files are rendered in memory, and changes to the output dir are
+	// printed instead of being made if set
+	dryRun bool
+	// a JSON list of written files is saved to manifestFile if set
+	manifestFile string
+}
 
-	// copy page resources to output dir
-	if err := filepath.Walk(contentBase, func(p string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() || strings.HasSuffix(info.Name(), ".md") {
-			return nil
-		}
-		return copyFile(path.Join(outputDir, strings.TrimPrefix(p, contentBase)), p)
-	}); err != nil {
-		panic(err)
-	}
-	// copy static files to output dir unmodified
-	if err := filepath.Walk(staticBase, func(p string, info os.FileInfo, err error) error {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return nil
-		}
-		return copyFile(path.Join(outputDir, strings.TrimPrefix(p, staticBase)), p)
-	}); err != nil {
-		panic(err)
+// exitWithErrors reports errors along with their number, and exits.
+func exitWithErrors(err error) {
+	if n := reportErrors(err); n == 1 {
+		fmt.Fprintln(os.Stderr, "gmnhg failed with 1 error")
+	} else {
+		fmt.Fprintf(os.Stderr, "gmnhg failed with %d errors\n", n)
 	}
+	os.Exit(1)
 }
@@ -0,0 +1,274 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// markerFilename marks output dirs gmnhg is allowed to wipe.
+const markerFilename = ".gmnhg"
+
+const markerContent = "This directory is generated by gmnhg, and its contents are replaced\non every build.\n"
+
+// outputDir writes the rendered site, keeping track of files written
+// during the build.
+type outputDir struct {
+	path string
+	// files are only written if their contents change, and files not
+	// written during the build are removed afterwards if set
+	sync bool
+	// nothing is written to disk if set
+	dryRun bool
+
+	mu    sync.Mutex
+	files map[string]manifestEntry
+}
+
+// manifestEntry describes a file written during the build.
+type manifestEntry struct {
+	// Path is relative to the output dir, unless the file is outside of
+	// it.
+	Path string `json:"path"`
+	// Source is the content or static file the file is rendered or
+	// copied from, if any.
+	Source string `json:"source,omitempty"`
+	// Template is the name of the template the file is rendered with,
+	// if any.
+	Template string `json:"template,omitempty"`
+	Size     int    `json:"size"`
+	SHA256   string `json:"sha256"`
+}
+
+// prepareOutputDir creates the output dir, or removes everything in it
+// unless sync is set. Non-empty dirs with no marker file are left alone
+// unless force is set, as they might not have been created by gmnhg.
+// With dryRun, the dir is only checked.
+func prepareOutputDir(dir string, force, sync, dryRun bool) (*outputDir, error) {
+	out := &outputDir{path: dir, sync: sync, dryRun: dryRun, files: make(map[string]manifestEntry)}
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		if !dryRun {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, err
+			}
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if len(entries) > 0 && !force {
+		if _, err := os.Stat(path.Join(dir, markerFilename)); os.IsNotExist(err) {
+			return nil, fmt.Errorf("refusing to overwrite %s: the directory is not empty and has no %s file created by gmnhg; use -force to overwrite it anyway", dir, markerFilename)
+		}
+	}
+	if !sync && !dryRun {
+		for _, entry := range entries {
+			if err := os.RemoveAll(path.Join(dir, entry.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := out.writeFile(path.Join(dir, markerFilename), "", "", []byte(markerContent)); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// exists tells whether dst has been written during the build.
+func (out *outputDir) exists(dst string) bool {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	_, ok := out.files[filepath.Clean(dst)]
+	return ok
+}
+
+// source returns the source file dst has been written from, if any.
+func (out *outputDir) source(dst string) string {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	return out.files[filepath.Clean(dst)].Source
+}
+
+// relPath returns the path of dst relative to the output dir, telling
+// whether dst is inside of it. Paths outside of it are returned as is.
+func (out *outputDir) relPath(dst string) (string, bool) {
+	rel, err := filepath.Rel(out.path, dst)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(dst), false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func (out *outputDir) record(dst, source, tmpl string, contents []byte) {
+	p, _ := out.relPath(dst)
+	sum := sha256.Sum256(contents)
+	out.mu.Lock()
+	out.files[filepath.Clean(dst)] = manifestEntry{
+		Path:     p,
+		Source:   source,
+		Template: tmpl,
+		Size:     len(contents),
+		SHA256:   hex.EncodeToString(sum[:]),
+	}
+	out.mu.Unlock()
+}
+
+// copyFile copies a static file or a page resource to dst.
+func (out *outputDir) copyFile(dst, src string) error {
+	contents, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return out.writeFile(dst, src, "", contents)
+}
+
+// writeFile writes a file rendered from source with the tmpl template
+// to dst.
+func (out *outputDir) writeFile(dst, source, tmpl string, contents []byte) error {
+	out.record(dst, source, tmpl, contents)
+	if out.dryRun {
+		return nil
+	}
+	if out.sync {
+		// leave unchanged files be to preserve their mtimes
+		if existing, err := ioutil.ReadFile(dst); err == nil && bytes.Equal(existing, contents) {
+			return nil
+		}
+	}
+	return writeFile(dst, contents)
+}
+
+// stale returns files in the output dir not written during the build.
+func (out *outputDir) stale() ([]string, error) {
+	var stale []string
+	err := filepath.Walk(out.path, func(p string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && p == out.path {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !out.exists(p) {
+			stale = append(stale, p)
+		}
+		return nil
+	})
+	return stale, err
+}
+
+// removeStale removes files not written during the build, along with
+// directories left empty, in sync mode.
+func (out *outputDir) removeStale() error {
+	if !out.sync || out.dryRun {
+		return nil
+	}
+	stale, err := out.stale()
+	if err != nil {
+		return err
+	}
+	dirs := make(map[string]bool)
+	for _, p := range stale {
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+		for dir := filepath.Dir(p); dir != filepath.Clean(out.path) && dir != "."; dir = filepath.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	// remove nested dirs first
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(sorted)))
+	for _, dir := range sorted {
+		if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) == 0 {
+			if err := os.Remove(dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reportChanges prints files a dry run would create, change, or remove
+// in the output dir, sorted by path.
+func (out *outputDir) reportChanges(w io.Writer) error {
+	stale, err := out.stale()
+	if err != nil {
+		return err
+	}
+	type change struct{ action, path string }
+	var changes []change
+	out.mu.Lock()
+	for dst, entry := range out.files {
+		// files outside of the output dir, such as redirects, are
+		// written regardless of its contents
+		if _, inside := out.relPath(dst); !inside {
+			continue
+		}
+		existing, err := ioutil.ReadFile(dst)
+		switch sum := sha256.Sum256(existing); {
+		case err != nil:
+			changes = append(changes, change{"create", entry.Path})
+		case hex.EncodeToString(sum[:]) != entry.SHA256:
+			changes = append(changes, change{"change", entry.Path})
+		}
+	}
+	out.mu.Unlock()
+	for _, p := range stale {
+		rel, _ := out.relPath(p)
+		changes = append(changes, change{"remove", rel})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].path < changes[j].path
+	})
+	for _, c := range changes {
+		fmt.Fprintf(w, "%s %s\n", c.action, c.path)
+	}
+	return nil
+}
+
+// manifest returns the list of files written during the build as JSON,
+// sorted by path.
+func (out *outputDir) manifest() ([]byte, error) {
+	out.mu.Lock()
+	entries := make([]manifestEntry, 0, len(out.files))
+	for _, entry := range out.files {
+		entries = append(entries, entry)
+	}
+	out.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	contents, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(contents, '\n'), nil
+}
@@ -0,0 +1,151 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeTree creates files with their contents in dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		if err := writeFile(filepath.Join(dir, name), []byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// listTree returns the sorted paths of files and dirs in dir, dirs
+// having a trailing slash.
+func listTree(t *testing.T, dir string) []string {
+	t.Helper()
+	var paths []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		if info.IsDir() {
+			rel += "/"
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestPrepareOutputDir(t *testing.T) {
+	tests := []struct {
+		name                string
+		files               map[string]string
+		force, sync, dryRun bool
+		want                []string
+		wantErr             bool
+	}{
+		{"new dir", nil, false, false, false, []string{markerFilename}, false},
+		{"marked dir", map[string]string{markerFilename: "", "old.gmi": ""}, false, false, false, []string{markerFilename}, false},
+		{"unmarked dir", map[string]string{"old.gmi": ""}, false, false, false, []string{"old.gmi"}, true},
+		{"unmarked dir with force", map[string]string{"old.gmi": ""}, true, false, false, []string{markerFilename}, false},
+		{"sync", map[string]string{markerFilename: "", "old.gmi": ""}, false, true, false, []string{markerFilename, "old.gmi"}, false},
+		{"dry run", map[string]string{markerFilename: "", "old.gmi": ""}, false, false, true, []string{markerFilename, "old.gmi"}, false},
+		{"dry run of an unmarked dir", map[string]string{"old.gmi": ""}, false, false, true, []string{"old.gmi"}, true},
+	}
+	for _, test := range tests {
+		dir := filepath.Join(t.TempDir(), "output")
+		writeTree(t, dir, test.files)
+		_, err := prepareOutputDir(dir, test.force, test.sync, test.dryRun)
+		switch {
+		case test.wantErr && (err == nil || !strings.Contains(err.Error(), "refusing to overwrite")):
+			t.Errorf("%s: got error %v, want a refusal to overwrite", test.name, err)
+		case !test.wantErr && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if got := listTree(t, dir); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got files %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPrepareOutputDirDryRunNewDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "output")
+	if _, err := prepareOutputDir(dir, false, false, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("%s is created on a dry run", dir)
+	}
+}
+
+func TestRemoveStale(t *testing.T) {
+	existing := map[string]string{
+		markerFilename:            markerContent,
+		"index.gmi":               "old index",
+		"posts/kept.gmi":          "kept",
+		"posts/removed.gmi":       "removed",
+		"old/nested/removed.gmi":  "removed",
+		"old/nested/removed2.gmi": "removed",
+	}
+	tests := []struct {
+		name         string
+		sync, dryRun bool
+		want         []string
+	}{
+		{"sync", true, false, []string{markerFilename, "index.gmi", "posts/", "posts/kept.gmi"}},
+		{"sync dry run", true, true, []string{markerFilename, "index.gmi", "old/", "old/nested/",
+			"old/nested/removed.gmi", "old/nested/removed2.gmi", "posts/", "posts/kept.gmi", "posts/removed.gmi"}},
+	}
+	for _, test := range tests {
+		dir := filepath.Join(t.TempDir(), "output")
+		writeTree(t, dir, existing)
+		out, err := prepareOutputDir(dir, false, test.sync, test.dryRun)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for name, contents := range map[string]string{"index.gmi": "new index", "posts/kept.gmi": "kept"} {
+			if err := out.writeFile(filepath.Join(dir, name), "", "", []byte(contents)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := out.removeStale(); err != nil {
+			t.Fatalf("%s: removeStale: %v", test.name, err)
+		}
+		if got := listTree(t, dir); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got files %v, want %v", test.name, got, test.want)
+		}
+		index, err := ioutil.ReadFile(filepath.Join(dir, "index.gmi"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "new index"
+		if test.dryRun {
+			want = "old index"
+		}
+		if string(index) != want {
+			t.Errorf("%s: got index %q, want %q", test.name, index, want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBindAddr = "localhost:1965"
+	// maximum request length, excluding CRLF, per the Gemini spec
+	maxRequestLength = 1024
+	requestTimeout   = 30 * time.Second
+)
+
+// serve builds the site to a temporary directory and serves it over
+// Gemini at addr until interrupted, rendering changed pages again if
+// watchChanges is set.
+func serve(opts buildOptions, addr string, watchChanges bool) error {
+	dir, err := ioutil.TempDir("", "gmnhg-serve-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	opts.outputDir = dir
+	host, err := previewHost(addr)
+	if err != nil {
+		return err
+	}
+	// make absolute links point to the preview server
+	opts.baseURL = "gemini://" + host + "/"
+	s, err := buildSite(opts)
+	if err != nil {
+		// keep serving what has been built to fix errors while watching
+		if !watchChanges {
+			return err
+		}
+		reportErrors(err)
+	}
+
+	cert, err := selfSignedCert(host)
+	if err != nil {
+		return err
+	}
+	listener, err := tls.Listen("tcp", addr, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	// the listener gets closed on interrupt, stopping the server
+	stopped := make(chan struct{})
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		close(stopped)
+		listener.Close()
+	}()
+
+	if watchChanges {
+		go watch(s, opts)
+	}
+	fmt.Fprintf(os.Stderr, "serving the site at gemini://%s/, press Ctrl+C to stop\n", host)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-stopped:
+				return nil
+			default:
+				return err
+			}
+		}
+		go handleGeminiRequest(conn, dir)
+	}
+}
+
+// previewHost returns the host and port clients reach the server bound
+// to addr at. Wildcard and empty hosts, as in :1965, are replaced with
+// localhost.
+func previewHost(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// selfSignedCert generates a throwaway TLS certificate for the host
+// clients reach the server at.
+func selfSignedCert(addr string) (tls.Certificate, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	} else if host != "" {
+		tmpl.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+func handleGeminiRequest(conn net.Conn, root string) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+	status, meta, body := respond(bufio.NewReader(conn), root)
+	fmt.Fprintf(conn, "%d %s\r\n", status, meta)
+	if body != nil {
+		conn.Write(body)
+	}
+}
+
+// respond reads a Gemini request and returns the response status, meta,
+// and body for a file under root.
+func respond(r *bufio.Reader, root string) (status int, meta string, body []byte) {
+	line, err := r.ReadSlice('\n')
+	if err != nil || len(line) > maxRequestLength+2 || !strings.HasSuffix(string(line), "\r\n") {
+		return 59, "Bad request", nil
+	}
+	request := strings.TrimSuffix(string(line), "\r\n")
+	uri, err := url.Parse(request)
+	if err != nil || !uri.IsAbs() {
+		return 59, "Bad request", nil
+	}
+	if uri.Scheme != "gemini" {
+		return 53, "Proxy request refused", nil
+	}
+	fmt.Fprintf(os.Stderr, "%s\n", request)
+
+	urlPath := path.Clean("/" + uri.Path)
+	file := filepath.Join(root, filepath.FromSlash(urlPath))
+	info, err := os.Stat(file)
+	if err != nil {
+		return 51, "Not found", nil
+	}
+	if info.IsDir() {
+		// relative links on index pages need the trailing slash
+		if !strings.HasSuffix(uri.Path, "/") {
+			uri.Path += "/"
+			return 31, uri.String(), nil
+		}
+		file = filepath.Join(file, indexFilename)
+	}
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 51, "Not found", nil
+	}
+	return 20, mimeType(file, contents), contents
+}
+
+// mimeType guesses the MIME type of a file by its extension, or by its
+// contents if the extension is unknown.
+func mimeType(file string, contents []byte) string {
+	switch ext := filepath.Ext(file); ext {
+	case ".gmi", ".gemini":
+		return "text/gemini; charset=utf-8"
+	case "":
+	default:
+		if t := mime.TypeByExtension(ext); t != "" {
+			return t
+		}
+	}
+	return http.DetectContentType(contents)
+}
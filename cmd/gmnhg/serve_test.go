@@ -0,0 +1,115 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRespond(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "public")
+	writeTree(t, dir, map[string]string{
+		"secret.gmi":               "secret",
+		"public/index.gmi":         "# Home\n",
+		"public/posts/index.gmi":   "# Posts\n",
+		"public/posts/p1.gmi":      "# P1\n",
+		"public/feed/rss.xml":      "<rss></rss>",
+		"public/files/notes":       "plain text",
+		"public/images/image.png":  "\x89PNG\r\n\x1a\n",
+		"public/posts/p1/data.txt": "text",
+	})
+	tests := []struct {
+		name    string
+		request string
+		status  int
+		meta    string
+		body    string
+	}{
+		{"index", "gemini://localhost/\r\n", 20, "text/gemini; charset=utf-8", "# Home\n"},
+		{"page", "gemini://localhost/posts/p1.gmi\r\n", 20, "text/gemini; charset=utf-8", "# P1\n"},
+		{"dir index", "gemini://localhost/posts/\r\n", 20, "text/gemini; charset=utf-8", "# Posts\n"},
+		{"dir without a trailing slash", "gemini://localhost/posts\r\n", 31, "gemini://localhost/posts/", ""},
+		{"dir with a query", "gemini://localhost/posts?q\r\n", 31, "gemini://localhost/posts/?q", ""},
+		{"text file", "gemini://localhost/posts/p1/data.txt\r\n", 20, "text/plain; charset=utf-8", "text"},
+		{"no extension", "gemini://localhost/files/notes\r\n", 20, "text/plain; charset=utf-8", "plain text"},
+		{"missing", "gemini://localhost/missing.gmi\r\n", 51, "Not found", ""},
+		{"traversal", "gemini://localhost/../secret.gmi\r\n", 51, "Not found", ""},
+		{"encoded traversal", "gemini://localhost/%2e%2e/secret.gmi\r\n", 51, "Not found", ""},
+		{"other scheme", "https://localhost/\r\n", 53, "Proxy request refused", ""},
+		{"relative URL", "/index.gmi\r\n", 59, "Bad request", ""},
+		{"no CRLF", "gemini://localhost/\n", 59, "Bad request", ""},
+		{"no line end", "gemini://localhost/", 59, "Bad request", ""},
+		{"oversized", "gemini://localhost/" + strings.Repeat("a", maxRequestLength) + "\r\n", 59, "Bad request", ""},
+	}
+	for _, test := range tests {
+		status, meta, body := respond(bufio.NewReader(strings.NewReader(test.request)), root)
+		if status != test.status || meta != test.meta || string(body) != test.body {
+			t.Errorf("%s: got %d %q %q, want %d %q %q", test.name, status, meta, body,
+				test.status, test.meta, test.body)
+		}
+	}
+}
+
+func TestMimeType(t *testing.T) {
+	tests := []struct {
+		file     string
+		contents string
+		want     string
+	}{
+		{"index.gmi", "", "text/gemini; charset=utf-8"},
+		{"page.gemini", "", "text/gemini; charset=utf-8"},
+		{"rss.xml", "<rss></rss>", "text/xml; charset=utf-8"},
+		{"image.png", "", "image/png"},
+		{"notes", "plain text", "text/plain; charset=utf-8"},
+		{"image", "\x89PNG\r\n\x1a\n", "image/png"},
+	}
+	for _, test := range tests {
+		if got := mimeType(test.file, []byte(test.contents)); got != test.want {
+			t.Errorf("mimeType(%q) = %q, want %q", test.file, got, test.want)
+		}
+	}
+}
+
+func TestPreviewHost(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"localhost:1965", "localhost:1965"},
+		{":1965", "localhost:1965"},
+		{"0.0.0.0:1965", "localhost:1965"},
+		{"[::]:1965", "localhost:1965"},
+		{"127.0.0.1:1966", "127.0.0.1:1966"},
+		{"example.com:1965", "example.com:1965"},
+	}
+	for _, test := range tests {
+		got, err := previewHost(test.addr)
+		if err != nil {
+			t.Errorf("previewHost(%q): unexpected error: %v", test.addr, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("previewHost(%q) = %q, want %q", test.addr, got, test.want)
+		}
+	}
+	if _, err := previewHost("localhost"); err == nil {
+		t.Errorf("previewHost(%q): expected an error", "localhost")
+	}
+}
@@ -0,0 +1,608 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/tdemin/gmnhg/internal/gmnhg"
+)
+
+// shortcode is a Hugo shortcode call found in content, like
+// {{< name "param" key="value" >}}.
+type shortcode struct {
+	name string
+	// positional parameters
+	args []string
+	// named parameters
+	params map[string]string
+	// set for {{% %}} shortcodes
+	isMarkdown bool
+	// text between the opening and the closing tag, if any
+	inner    []byte
+	hasInner bool
+	// byte offsets of the entire call in the source, closing tag
+	// included
+	start, end int
+	// source line of the opening tag
+	line int
+}
+
+// get returns a named parameter, falling back to the positional one.
+func (s shortcode) get(name string, position int) string {
+	if v, ok := s.params[name]; ok {
+		return v
+	}
+	if position < len(s.args) {
+		return s.args[position]
+	}
+	return ""
+}
+
+var (
+	errShortcodeUnclosed = errors.New("unclosed shortcode tag")
+	errShortcodeNoName   = errors.New("shortcode has no name")
+)
+
+// shortcodeTag is a single opening or closing shortcode tag.
+type shortcodeTag struct {
+	shortcode
+	isClosing, isSelfClosing bool
+	// comment tags like {{</* name */>}} are printed as is, sans the
+	// comment delimiters
+	isComment bool
+	literal   []byte
+}
+
+// nextShortcodeTag finds the first shortcode tag in src starting at
+// offset. Returns ok = false if there's none.
+func nextShortcodeTag(src []byte, offset int) (tag shortcodeTag, ok bool, err error) {
+	i := bytes.Index(src[offset:], []byte("{{"))
+	for ; i != -1; i = bytes.Index(src[offset:], []byte("{{")) {
+		start := offset + i
+		rest := src[start+2:]
+		if len(rest) > 0 && (rest[0] == '<' || rest[0] == '%') {
+			opening, closing := string(rest[0]), ">}}"
+			tag.start = start
+			tag.isMarkdown = opening == "%"
+			if tag.isMarkdown {
+				closing = "%}}"
+			}
+			body := rest[1:]
+			if bytes.HasPrefix(body, []byte("/*")) {
+				end := bytes.Index(body, []byte("*/"+closing))
+				if end == -1 {
+					return tag, false, errShortcodeUnclosed
+				}
+				tag.isComment = true
+				tag.end = start + 3 + end + 2 + len(closing)
+				tag.literal = []byte("{{" + opening + string(body[2:end]) + closing)
+				return tag, true, nil
+			}
+			end := findTagEnd(body, []byte(closing))
+			if end == -1 {
+				return tag, false, errShortcodeUnclosed
+			}
+			tag.end = start + 3 + end + 3
+			if err := tag.parse(body[:end]); err != nil {
+				return tag, false, err
+			}
+			return tag, true, nil
+		}
+		offset = start + 2
+	}
+	return tag, false, nil
+}
+
+// findTagEnd returns the index of the closing delimiter of a tag,
+// skipping over quoted parameters.
+func findTagEnd(body, closing []byte) int {
+	var quote byte
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '`':
+			quote = c
+		case bytes.HasPrefix(body[i:], closing):
+			return i
+		}
+	}
+	return -1
+}
+
+// parse fills tag data from the text between tag delimiters.
+func (tag *shortcodeTag) parse(body []byte) error {
+	text := strings.TrimSpace(string(body))
+	if strings.HasSuffix(text, "/") {
+		tag.isSelfClosing = true
+		text = strings.TrimSpace(strings.TrimSuffix(text, "/"))
+	}
+	if strings.HasPrefix(text, "/") {
+		tag.isClosing = true
+		text = strings.TrimSpace(strings.TrimPrefix(text, "/"))
+	}
+	tokens, err := tokenizeShortcode(text)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return errShortcodeNoName
+	}
+	tag.name = tokens[0]
+	tag.params = make(map[string]string)
+	for _, token := range tokens[1:] {
+		if eq := strings.IndexByte(token, '='); eq > 0 && !strings.ContainsAny(token[:eq], "\"`") {
+			tag.params[token[:eq]] = unquoteShortcodeParam(token[eq+1:])
+			continue
+		}
+		tag.args = append(tag.args, unquoteShortcodeParam(token))
+	}
+	return nil
+}
+
+// tokenizeShortcode splits tag text by whitespace, keeping quoted
+// strings together.
+func tokenizeShortcode(text string) (tokens []string, err error) {
+	var (
+		current strings.Builder
+		quote   rune
+		escaped bool
+	)
+	for _, c := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '`':
+			quote = c
+		case unicode.IsSpace(c):
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+			continue
+		}
+		current.WriteRune(c)
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in shortcode %q", text)
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens, nil
+}
+
+func unquoteShortcodeParam(value string) string {
+	if len(value) >= 2 {
+		switch value[0] {
+		case '"':
+			var b strings.Builder
+			escaped := false
+			for _, c := range value[1 : len(value)-1] {
+				if c == '\\' && !escaped {
+					escaped = true
+					continue
+				}
+				escaped = false
+				b.WriteRune(c)
+			}
+			return b.String()
+		case '`':
+			return value[1 : len(value)-1]
+		}
+	}
+	return value
+}
+
+// findClosingTag looks for the tag closing a shortcode named name,
+// taking nested shortcodes of the same name into account.
+func findClosingTag(src []byte, offset int, name string) (tag shortcodeTag, ok bool, err error) {
+	depth := 0
+	for {
+		tag, ok, err := nextShortcodeTag(src, offset)
+		if err != nil || !ok {
+			return tag, false, err
+		}
+		offset = tag.end
+		if tag.isComment || tag.name != name || tag.isSelfClosing {
+			continue
+		}
+		if !tag.isClosing {
+			depth++
+			continue
+		}
+		if depth == 0 {
+			return tag, true, nil
+		}
+		depth--
+	}
+}
+
+// shortcodeHandler renders a shortcode call.
+type shortcodeHandler func(s shortcode) (output []byte, err error)
+
+// expandShortcodes replaces top-level shortcode calls in src with the
+// output of handle. Comment shortcodes are unescaped. Line numbers are
+// counted starting from firstLine.
+func expandShortcodes(src []byte, firstLine int, handle shortcodeHandler) ([]byte, error) {
+	buf := bytes.Buffer{}
+	offset := 0
+	line := func(offset int) int {
+		return firstLine + lineNumber(src, offset) - 1
+	}
+	for {
+		tag, ok, err := nextShortcodeTag(src, offset)
+		if err != nil {
+			return nil, &shortcodeError{Line: line(tag.start), Err: err}
+		}
+		if !ok {
+			break
+		}
+		buf.Write(src[offset:tag.start])
+		offset = tag.end
+		if tag.isComment {
+			buf.Write(tag.literal)
+			continue
+		}
+		if tag.isClosing {
+			return nil, &shortcodeError{
+				Line: line(tag.start),
+				Err:  fmt.Errorf("closing shortcode tag %q without an opening one", tag.name),
+			}
+		}
+		s := tag.shortcode
+		s.line = line(tag.start)
+		if !tag.isSelfClosing {
+			closing, ok, err := findClosingTag(src, tag.end, tag.name)
+			if err != nil {
+				return nil, &shortcodeError{Line: s.line, Err: err}
+			}
+			if ok {
+				s.inner = src[tag.end:closing.start]
+				s.hasInner = true
+				s.end = closing.end
+				offset = closing.end
+			}
+		}
+		output, err := handle(s)
+		if err != nil {
+			var scErr *shortcodeError
+			if errors.As(err, &scErr) {
+				return nil, err
+			}
+			return nil, &shortcodeError{Line: s.line, Err: err}
+		}
+		buf.Write(output)
+	}
+	buf.Write(src[offset:])
+	return buf.Bytes(), nil
+}
+
+func lineNumber(src []byte, offset int) int {
+	return bytes.Count(src[:offset], []byte{'\n'}) + 1
+}
+
+// shortcodeError reports a shortcode which failed to expand.
+type shortcodeError struct {
+	Line int
+	Err  error
+}
+
+func (e *shortcodeError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *shortcodeError) Unwrap() error {
+	return e.Err
+}
+
+// refResolver resolves Hugo ref and relref shortcodes against the site
+// page map.
+type refResolver struct {
+	// output files by content paths relative to the content dir
+	pages map[string]string
+	// prefix for absolute links produced by ref
+	baseURL string
+}
+
+// resolve finds the output file for a ref target, as seen from the
+// content file at contentPath. Targets are looked up relative to the
+// page, then relative to the content dir, and finally by the file name
+// if it's unique.
+func (r refResolver) resolve(contentPath, target string) (string, bool) {
+	candidates := func(p string) []string {
+		p = strings.Trim(path.Clean(p), "/")
+		if p == "." || p == "" {
+			return []string{hugoIndexMdFilename, geminiIndexMdFilename}
+		}
+		return []string{
+			p,
+			p + ".md",
+			p + "/index.md",
+			p + "/" + hugoIndexMdFilename,
+			p + "/" + geminiIndexMdFilename,
+		}
+	}
+	var lookup []string
+	if !path.IsAbs(target) {
+		lookup = append(lookup, candidates(path.Join(path.Dir(contentPath), target))...)
+	}
+	lookup = append(lookup, candidates(target)...)
+	for _, p := range lookup {
+		if output, ok := r.pages[p]; ok {
+			return output, true
+		}
+	}
+	// Hugo allows referencing pages by file name alone
+	var found []string
+	for p, output := range r.pages {
+		if base := path.Base(p); base == target || base == target+".md" {
+			found = append(found, output)
+		}
+	}
+	if len(found) == 1 {
+		return found[0], true
+	}
+	return "", false
+}
+
+// ref renders the ref and relref shortcodes found in the content file
+// at contentPath.
+func (r refResolver) ref(contentPath string, s shortcode) ([]byte, error) {
+	target := s.get("path", 0)
+	var fragment string
+	if i := strings.IndexByte(target, '#'); i != -1 {
+		target, fragment = target[:i], target[i:]
+	}
+	// fragment-only refs point to the page itself
+	output, ok := r.pages[contentPath]
+	if target != "" {
+		output, ok = r.resolve(contentPath, target)
+	}
+	if !ok {
+		return nil, fmt.Errorf("cannot resolve %s %q", s.name, s.get("path", 0))
+	}
+	link := "/" + output
+	if s.name == "ref" && r.baseURL != "" {
+		link = strings.TrimSuffix(r.baseURL, "/") + link
+	}
+	return []byte(link + fragment), nil
+}
+
+// shortcodeData is passed to shortcode templates.
+type shortcodeData struct {
+	// Name is the shortcode name.
+	Name string
+	// Params is a map of named parameters, or a slice of positional
+	// ones if there are no named ones.
+	Params interface{}
+	// Inner is the text between the opening and the closing tags, with
+	// nested shortcodes already expanded.
+	Inner string
+	// Page contains the link and the metadata of the page the
+	// shortcode is called on.
+	Page gmnhg.Post
+
+	args   []string
+	params map[string]string
+}
+
+// Get returns a parameter either by its position, if key is an int, or
+// by its name. Returns an empty string if there is no such parameter.
+func (d shortcodeData) Get(key interface{}) string {
+	switch key := key.(type) {
+	case int:
+		if key >= 0 && key < len(d.args) {
+			return d.args[key]
+		}
+	case string:
+		return d.params[key]
+	}
+	return ""
+}
+
+// placeholder marking the place where Gemtext output of a shortcode
+// goes; Markdown rendering leaves it intact
+const shortcodePlaceholder = "GMNHGSHORTCODE%dEND"
+
+// shortcodeRenderer expands shortcodes found in a single content file.
+// Shortcodes called with {{% %}} produce Markdown which gets rendered
+// along with the rest of the file, while the ones called with {{< >}}
+// produce Gemtext inserted after rendering.
+type shortcodeRenderer struct {
+	refs      refResolver
+	templates map[string]*template.Template
+	// content path relative to the content dir
+	contentPath string
+	page        gmnhg.Post
+	// Gemtext output of {{< >}} shortcodes in the order of calls
+	outputs []shortcodeOutput
+	// called for shortcodes having no template
+	warn func(line int, name string)
+}
+
+func (r *shortcodeRenderer) handle(s shortcode) ([]byte, error) {
+	if s.name == "ref" || s.name == "relref" {
+		return r.refs.ref(r.contentPath, s)
+	}
+	inner, err := expandShortcodes(s.inner, s.line, r.handle)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, ok := r.templates["shortcodes/"+s.name]
+	if !ok {
+		// strip unknown shortcodes, keeping their content
+		if r.warn != nil {
+			r.warn(s.line, s.name)
+		}
+		return inner, nil
+	}
+	data := shortcodeData{
+		Name:   s.name,
+		Params: s.args,
+		Inner:  string(inner),
+		Page:   r.page,
+		args:   s.args,
+		params: s.params,
+	}
+	if len(s.params) > 0 {
+		data.Params = s.params
+	}
+	buf := bytes.Buffer{}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	if s.isMarkdown {
+		return buf.Bytes(), nil
+	}
+	r.outputs = append(r.outputs, shortcodeOutput{
+		name:    s.name,
+		line:    s.line,
+		gemtext: bytes.TrimRight(buf.Bytes(), "\n"),
+	})
+	return []byte(fmt.Sprintf(shortcodePlaceholder, len(r.outputs)-1)), nil
+}
+
+// expand expands shortcodes in Markdown content starting at firstLine
+// of the content file.
+func (r *shortcodeRenderer) expand(content []byte, firstLine int) ([]byte, error) {
+	return expandShortcodes(content, firstLine, r.handle)
+}
+
+// insertGemtext replaces placeholders in rendered Gemtext with output
+// of the relevant shortcodes.
+func (r *shortcodeRenderer) insertGemtext(gemtext []byte) ([]byte, error) {
+	// shortcodes wrapping other shortcodes come last and may contain
+	// placeholders of the nested ones
+	for i := len(r.outputs) - 1; i >= 0; i-- {
+		out := r.outputs[i]
+		placeholder := []byte(fmt.Sprintf(shortcodePlaceholder, i))
+		var err error
+		if gemtext, err = insertOutput(gemtext, placeholder, out.gemtext); err != nil {
+			return nil, &shortcodeError{Line: out.line, Err: fmt.Errorf("shortcode %q: %w", out.name, err)}
+		}
+	}
+	return gemtext, nil
+}
+
+// shortcodeOutput is the Gemtext output of a {{< >}} shortcode call.
+type shortcodeOutput struct {
+	name    string
+	line    int
+	gemtext []byte
+}
+
+// lineMarkers start Gemtext lines that are only recognized at the
+// start of a line.
+var lineMarkers = [][]byte{[]byte("=>"), []byte("#"), []byte("```")}
+
+func hasLineMarker(line []byte) bool {
+	for _, marker := range lineMarkers {
+		if bytes.HasPrefix(line, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// countToggles returns the number of preformatted toggle lines in
+// Gemtext.
+func countToggles(gemtext []byte) int {
+	n := 0
+	for _, line := range bytes.Split(gemtext, []byte{'\n'}) {
+		if bytes.HasPrefix(line, []byte("```")) {
+			n++
+		}
+	}
+	return n
+}
+
+// insertOutput replaces placeholder in Gemtext with shortcode output.
+// Output starting with a link, a heading, or a preformatted block is
+// only recognized at the start of a line, so the text line around the
+// placeholder is broken to put the output on lines of its own, the
+// rest of a quote staying quoted. Such output can't be placed inside
+// headings, links, or preformatted blocks.
+func insertOutput(gemtext, placeholder, output []byte) ([]byte, error) {
+	if !hasLineMarker(output) {
+		return bytes.ReplaceAll(gemtext, placeholder, output), nil
+	}
+	buf := bytes.Buffer{}
+	toggles := 0
+	for {
+		i := bytes.Index(gemtext, placeholder)
+		if i == -1 {
+			break
+		}
+		lineStart := bytes.LastIndexByte(gemtext[:i], '\n') + 1
+		lineEnd := len(gemtext)
+		if end := bytes.IndexByte(gemtext[i:], '\n'); end != -1 {
+			lineEnd = i + end
+		}
+		toggles += countToggles(gemtext[:lineStart])
+		before, after := gemtext[lineStart:i], gemtext[i+len(placeholder):lineEnd]
+		switch {
+		case toggles%2 == 1:
+			return nil, fmt.Errorf("output starting with %q can't be placed inside a preformatted block", firstLineOf(output))
+		case hasLineMarker(before):
+			return nil, fmt.Errorf("output starting with %q can't be placed inside a heading or a link", firstLineOf(output))
+		}
+		buf.Write(gemtext[:lineStart])
+		if trimmed := bytes.TrimRight(before, " \t"); len(trimmed) > 0 && !bytes.Equal(trimmed, []byte(">")) {
+			buf.Write(trimmed)
+			buf.WriteByte('\n')
+		}
+		buf.Write(output)
+		if after := bytes.TrimLeft(after, " \t"); len(after) > 0 {
+			buf.WriteByte('\n')
+			// the rest of a quote stays quoted
+			if bytes.HasPrefix(before, []byte(">")) {
+				buf.WriteString("> ")
+			}
+			buf.Write(after)
+		}
+		toggles += countToggles(output)
+		gemtext = gemtext[lineEnd:]
+	}
+	buf.Write(gemtext)
+	return buf.Bytes(), nil
+}
+
+// firstLineOf returns the first line of text.
+func firstLineOf(text []byte) []byte {
+	if i := bytes.IndexByte(text, '\n'); i != -1 {
+		return text[:i]
+	}
+	return text
+}
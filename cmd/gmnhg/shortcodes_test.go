@@ -0,0 +1,235 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"text/template"
+)
+
+func TestExpandShortcodes(t *testing.T) {
+	handle := func(s shortcode) ([]byte, error) {
+		return []byte(fmt.Sprintf("<%s %q %q %t %q>", s.name, s.args, s.params, s.hasInner, s.inner)), nil
+	}
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"no shortcodes", "plain {{ text }}", "plain {{ text }}"},
+		{"parameters", `a {{< foo "bar baz" key="v" >}} b`, `a <foo ["bar baz"] map["key":"v"] false ""> b`},
+		{"markdown", `{{% md x %}}`, `<md ["x"] map[] false "">`},
+		{"self-closing", `{{< foo />}}text`, `<foo [] map[] false "">text`},
+		{"inner", `{{< note >}}text{{< /note >}}`, `<note [] map[] true "text">`},
+		{"nested", `{{< n >}}a{{< n >}}b{{< /n >}}c{{< /n >}}`, `<n [] map[] true "a{{< n >}}b{{< /n >}}c">`},
+		{"comment", `{{</* foo "x" */>}}`, `{{< foo "x" >}}`},
+		{"escaped quote", `{{< foo "a \"b\"" >}}`, `<foo ["a \"b\""] map[] false "">`},
+		{"raw string", "{{< foo `a \\\"b` >}}", `<foo ["a \\\"b"] map[] false "">`},
+		{"delimiter in quotes", `{{< foo "x >}}" >}}`, `<foo ["x >}}"] map[] false "">`},
+		{"quoted equals sign", `{{< foo "a=b" >}}`, `<foo ["a=b"] map[] false "">`},
+	}
+	for _, test := range tests {
+		got, err := expandShortcodes([]byte(test.src), 1, handle)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestExpandShortcodesErrors(t *testing.T) {
+	handle := func(s shortcode) ([]byte, error) {
+		if s.name == "fail" {
+			return nil, fmt.Errorf("failed")
+		}
+		return nil, nil
+	}
+	tests := []struct {
+		name      string
+		src       string
+		firstLine int
+		want      string
+	}{
+		{"unclosed tag", "{{< foo", 1, "line 1: unclosed shortcode tag"},
+		{"unclosed quote", "{{< foo \"bar >}}", 1, "line 1: unclosed shortcode tag"},
+		{"no name", "text\n{{<  >}}", 1, "line 2: shortcode has no name"},
+		{"stray closing tag", "text\n{{< /foo >}}", 1, `line 2: closing shortcode tag "foo" without an opening one`},
+		{"first line", "text\n{{< /foo >}}", 5, `line 6: closing shortcode tag "foo" without an opening one`},
+		{"handler error", "\n\n{{< fail >}}", 1, "line 3: failed"},
+	}
+	for _, test := range tests {
+		_, err := expandShortcodes([]byte(test.src), test.firstLine, handle)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		if err.Error() != test.want {
+			t.Errorf("%s: got error %q, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestRefResolver(t *testing.T) {
+	r := refResolver{
+		pages: map[string]string{
+			"_index.md":             "index.gmi",
+			"about.md":              "about.gmi",
+			"posts/_index.md":       "posts/index.gmi",
+			"posts/first.md":        "posts/first.gmi",
+			"posts/second/index.md": "posts/second/index.gmi",
+			"posts/intro.md":        "posts/intro.gmi",
+			"notes/intro.md":        "notes/intro.gmi",
+		},
+		baseURL: "gemini://example.com/",
+	}
+	tests := []struct {
+		name        string
+		contentPath string
+		shortcode   shortcode
+		want        string
+	}{
+		{"relative", "posts/first.md", shortcode{name: "relref", args: []string{"second"}}, "/posts/second/index.gmi"},
+		{"relative file", "posts/first.md", shortcode{name: "relref", args: []string{"intro.md"}}, "/posts/intro.gmi"},
+		{"content dir", "posts/first.md", shortcode{name: "relref", args: []string{"about.md"}}, "/about.gmi"},
+		{"absolute section", "about.md", shortcode{name: "relref", args: []string{"/posts"}}, "/posts/index.gmi"},
+		{"site root", "about.md", shortcode{name: "relref", args: []string{"/"}}, "/index.gmi"},
+		{"file name", "about.md", shortcode{name: "relref", args: []string{"first"}}, "/posts/first.gmi"},
+		{"fragment", "posts/first.md", shortcode{name: "relref", args: []string{"second#part"}}, "/posts/second/index.gmi#part"},
+		{"fragment only", "posts/first.md", shortcode{name: "relref", args: []string{"#part"}}, "/posts/first.gmi#part"},
+		{"named parameter", "posts/first.md", shortcode{name: "relref", params: map[string]string{"path": "/about"}}, "/about.gmi"},
+		{"ref", "posts/first.md", shortcode{name: "ref", args: []string{"/about"}}, "gemini://example.com/about.gmi"},
+	}
+	for _, test := range tests {
+		got, err := r.ref(test.contentPath, test.shortcode)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	errorTests := []struct {
+		name      string
+		shortcode shortcode
+		want      string
+	}{
+		{"missing", shortcode{name: "relref", args: []string{"missing"}}, `cannot resolve relref "missing"`},
+		{"ambiguous file name", shortcode{name: "ref", args: []string{"intro"}}, `cannot resolve ref "intro"`},
+	}
+	for _, test := range errorTests {
+		_, err := r.ref("about.md", test.shortcode)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		if err.Error() != test.want {
+			t.Errorf("%s: got error %q, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestInsertOutput(t *testing.T) {
+	const link = "=> /a A"
+	tests := []struct {
+		name    string
+		gemtext string
+		output  string
+		want    string
+	}{
+		{"inline output", "a PH b", "x", "a x b"},
+		{"line of its own", "PH", link, link},
+		{"text line", "text PH more", link, "text\n" + link + "\nmore"},
+		{"list item", "* item PH", link, "* item\n" + link},
+		{"quote", "> said PH then", link, "> said\n" + link + "\n> then"},
+		{"quote start", "> PH", link, link},
+		{"after preformatted block", "```\ncode\n```\nPH", link, "```\ncode\n```\n" + link},
+		{"several placeholders", "PH\nx PH", link, link + "\nx\n" + link},
+		{"preformatted output", "a PH\nb PH", "```\nc\n```", "a\n```\nc\n```\nb\n```\nc\n```"},
+	}
+	for _, test := range tests {
+		got, err := insertOutput([]byte(test.gemtext), []byte("PH"), []byte(test.output))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	errorTests := []struct {
+		name    string
+		gemtext string
+		want    string
+	}{
+		{"heading", "# Title PH", `output starting with "=> /a A" can't be placed inside a heading or a link`},
+		{"link", "=> /b PH", `output starting with "=> /a A" can't be placed inside a heading or a link`},
+		{"preformatted block", "```\nPH\n```", `output starting with "=> /a A" can't be placed inside a preformatted block`},
+	}
+	for _, test := range errorTests {
+		_, err := insertOutput([]byte(test.gemtext), []byte("PH"), []byte(link))
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		if err.Error() != test.want {
+			t.Errorf("%s: got error %q, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestShortcodeRenderer(t *testing.T) {
+	templates := map[string]*template.Template{
+		"shortcodes/link": template.Must(template.New("").Parse(`=> {{ .Get 0 }} {{ .Inner }}`)),
+		"shortcodes/md":   template.Must(template.New("").Parse(`**{{ .Get "x" }}**`)),
+	}
+	var warnings []string
+	r := shortcodeRenderer{
+		templates:   templates,
+		contentPath: "post.md",
+		warn: func(line int, name string) {
+			warnings = append(warnings, fmt.Sprintf("%d %s", line, name))
+		},
+	}
+	src := "see {{< link \"/a\" >}}A{{< /link >}} now\n{{% md x=\"y\" %}} {{< unknown >}}kept{{< /unknown >}}"
+	markdown, err := r.expand([]byte(src), 3)
+	if err != nil {
+		t.Fatalf("expand: unexpected error: %v", err)
+	}
+	if want := "see GMNHGSHORTCODE0END now\n**y** kept"; string(markdown) != want {
+		t.Errorf("expand: got %q, want %q", markdown, want)
+	}
+	if want := []string{"4 unknown"}; fmt.Sprint(warnings) != fmt.Sprint(want) {
+		t.Errorf("warnings: got %q, want %q", warnings, want)
+	}
+	gemtext, err := r.insertGemtext(markdown)
+	if err != nil {
+		t.Fatalf("insertGemtext: unexpected error: %v", err)
+	}
+	if want := "see\n=> /a A\nnow\n**y** kept"; string(gemtext) != want {
+		t.Errorf("insertGemtext: got %q, want %q", gemtext, want)
+	}
+	_, err = r.insertGemtext([]byte("# GMNHGSHORTCODE0END"))
+	if want := `line 3: shortcode "link": output starting with "=> /a A" can't be placed inside a heading or a link`; err == nil || err.Error() != want {
+		t.Errorf("insertGemtext: got error %v, want %q", err, want)
+	}
+}
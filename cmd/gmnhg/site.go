@@ -0,0 +1,975 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+
+	gemini "github.com/tdemin/gmnhg"
+	"github.com/tdemin/gmnhg/internal/gmnhg"
+)
+
+// site holds everything needed to render a Hugo site, so that parts of
+// it can be rendered again as files change.
+type site struct {
+	opts               buildOptions
+	conf               SiteConfig
+	renderOptions      gemini.Options
+	rewriter           *linkRewriter
+	templates          map[string]*template.Template
+	rssTemplate        *template.Template
+	shortcodeTemplates map[string]*template.Template
+	languages          []*language
+	out                *outputDir
+	// pages are published as of this time
+	now time.Time
+
+	// directories containing an index.* file
+	leafIndexPaths []string
+	// pages to be rendered, in the content dir walk order
+	sources       []source
+	posts         map[string]gmnhg.Post
+	topLevelPosts map[string]gmnhg.Posts
+	redirects     []redirect
+
+	// errors of files that failed to render with -keep-going
+	errs errorList
+}
+
+// source is a content file of a page to be rendered.
+type source struct {
+	path, key            string
+	fileContent, content []byte
+	metadata             gmnhg.Metadata
+	isLeafIndex          bool
+
+	lang *language
+	// path relative to the language content dir with no language
+	// suffix, shared by translations of the page
+	translationPath string
+	// path the file would have in content/ if every language had its
+	// own subdir there
+	virtualPath string
+}
+
+// loadSiteConfig reads the Hugo config, returning the config file name
+// along with it.
+func loadSiteConfig() (SiteConfig, string, error) {
+	var siteConf SiteConfig
+	for _, filename := range hugoConfigFiles {
+		if fileInfo, err := os.Stat(filename); os.IsNotExist(err) || fileInfo.IsDir() {
+			continue
+		}
+		buf, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return siteConf, filename, err
+		}
+		switch ext := filepath.Ext(filename); ext {
+		case ".toml":
+			err = toml.Unmarshal(buf, &siteConf)
+		case ".yaml":
+			err = yaml.Unmarshal(buf, &siteConf)
+		case ".json":
+			err = json.Unmarshal(buf, &siteConf)
+		}
+		if err != nil {
+			return siteConf, filename, &buildError{Source: filename, Err: err}
+		}
+		return siteConf, filename, nil
+	}
+	return siteConf, "", fmt.Errorf("no Hugo config in %v found; not in a Hugo site dir?", hugoConfigFiles)
+}
+
+// loadTemplates parses all template files, reporting errors of all
+// templates that fail to parse. Templates in partials/ are available
+// to all others, and templates consisting of definitions only, like
+// {{ define "main" }}...{{ end }}, are rendered with the baseof
+// template of their directory, or _default/baseof, filling in its
+// blocks. Neither partials nor baseof templates are returned. funcs
+// are added to the template functions.
+func loadTemplates(funcs template.FuncMap) (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template)
+	if _, err := os.Stat(templateBase); os.IsNotExist(err) {
+		return templates, nil
+	}
+	var (
+		names    []string
+		paths    = make(map[string]string)
+		contents = make(map[string]string)
+	)
+	err := filepath.Walk(templateBase, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		name := tmplNameRegex.FindStringSubmatch(path)
+		if name == nil || len(name) != 2 {
+			return nil
+		}
+		tmplName := name[1]
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		names = append(names, tmplName)
+		paths[tmplName], contents[tmplName] = path, string(buf)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var errs errorList
+	shared := template.New("").Funcs(defineFuncMap()).Funcs(funcs)
+	for _, name := range names {
+		if !strings.HasPrefix(name, partialsDir) {
+			continue
+		}
+		if _, err := shared.New(name).Parse(contents[name]); err != nil {
+			errs = append(errs, templateParseError(paths[name], name, err))
+		}
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, partialsDir) {
+			errs = append(errs, undefinedTemplates(shared, paths[name], name)...)
+		}
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, partialsDir) {
+			continue
+		}
+		set, err := shared.Clone()
+		if err != nil {
+			return nil, err
+		}
+		// baseof templates fail to parse on their own as well
+		base := baseofName(name, contents)
+		if base != "" {
+			if _, err := set.New(base).Parse(contents[base]); err != nil {
+				base = ""
+			}
+		}
+		tmpl, err := set.New(name).Parse(contents[name])
+		if err != nil {
+			errs = append(errs, templateParseError(paths[name], name, err))
+			continue
+		}
+		if base != "" && (tmpl.Tree == nil || parse.IsEmptyTree(tmpl.Tree.Root)) {
+			if _, err := tmpl.Parse(fmt.Sprintf("{{ template %q . }}", base)); err != nil {
+				return nil, err
+			}
+		}
+		errs = append(errs, undefinedTemplates(set, paths[name], name)...)
+		if path.Base(name) != baseofTemplate {
+			templates[name] = tmpl
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return templates, nil
+}
+
+// baseofName returns the name of the baseof template for the template
+// with name, or an empty string if there's none.
+func baseofName(name string, contents map[string]string) string {
+	if path.Base(name) == baseofTemplate {
+		return ""
+	}
+	for _, base := range []string{path.Join(path.Dir(name), baseofTemplate), "_default/" + baseofTemplate} {
+		if _, ok := contents[base]; ok {
+			return base
+		}
+	}
+	return ""
+}
+
+// undefinedTemplates reports templates invoked by the template file
+// parsed as name, but not defined in set.
+func undefinedTemplates(set *template.Template, source, name string) []error {
+	var trees []*parse.Tree
+	for _, t := range set.Templates() {
+		if t.Tree != nil && t.Tree.ParseName == name {
+			trees = append(trees, t.Tree)
+		}
+	}
+	// report errors in the order of the file
+	sort.Slice(trees, func(i, j int) bool {
+		return trees[i].Root.Position() < trees[j].Root.Position()
+	})
+	var errs []error
+	for _, tree := range trees {
+		walkTemplateNodes(tree.Root, func(n *parse.TemplateNode) {
+			if set.Lookup(n.Name) == nil {
+				location, _ := tree.ErrorContext(n)
+				err := fmt.Errorf("template: %s: undefined template %q", location, n.Name)
+				errs = append(errs, templateParseError(source, name, err))
+			}
+		})
+	}
+	return errs
+}
+
+// walkTemplateNodes calls visit for every {{ template }} action found
+// in the node tree.
+func walkTemplateNodes(node parse.Node, visit func(*parse.TemplateNode)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkTemplateNodes(child, visit)
+		}
+	case *parse.IfNode:
+		walkTemplateNodes(n.List, visit)
+		walkTemplateNodes(n.ElseList, visit)
+	case *parse.RangeNode:
+		walkTemplateNodes(n.List, visit)
+		walkTemplateNodes(n.ElseList, visit)
+	case *parse.WithNode:
+		walkTemplateNodes(n.List, visit)
+		walkTemplateNodes(n.ElseList, visit)
+	case *parse.TemplateNode:
+		visit(n)
+	}
+}
+
+// loadSite reads the site in the current directory and renders its
+// pages to Gemtext, without writing anything to the output dir.
+func loadSite(opts buildOptions) (*site, error) {
+	siteConf, configFile, err := loadSiteConfig()
+	if err != nil {
+		return nil, err
+	}
+	if opts.baseURL != "" {
+		siteConf.Gmnhg.BaseURL = opts.baseURL
+	}
+	renderOptions, err := siteConf.Gmnhg.renderOptions()
+	if err != nil {
+		return nil, &buildError{Source: configFile, Err: err}
+	}
+	languages, err := siteConf.languages()
+	if err != nil {
+		return nil, &buildError{Source: configFile, Err: err}
+	}
+	// links between pages are rewritten to point to the rendered files
+	var rewriter *linkRewriter
+	if siteConf.Gmnhg.AbsoluteLinks {
+		rewriter, err = newLinkRewriter(siteConf.Gmnhg.BaseURL)
+	} else {
+		rewriter, err = newLinkRewriter("")
+	}
+	if err != nil {
+		return nil, err
+	}
+	templates, err := loadTemplates(siteFuncMap(siteConf, renderOptions))
+	if err != nil {
+		return nil, err
+	}
+	// the site-wide RSS template, user-defined one taking precedence
+	rssTemplate := defaultRssTemplate
+	if tmpl, hasTmpl := templates["_default/rss"]; hasTmpl {
+		rssTemplate = tmpl
+	}
+
+	// shortcode templates, user-defined ones taking precedence
+	shortcodeTemplates := make(map[string]*template.Template)
+	for name, tmpl := range defaultShortcodeTemplates {
+		shortcodeTemplates["shortcodes/"+name] = tmpl
+	}
+	for name, tmpl := range templates {
+		if strings.HasPrefix(name, "shortcodes/") {
+			shortcodeTemplates[name] = tmpl
+		}
+	}
+
+	s := &site{
+		opts:               opts,
+		conf:               siteConf,
+		renderOptions:      renderOptions,
+		rewriter:           rewriter,
+		templates:          templates,
+		rssTemplate:        rssTemplate,
+		shortcodeTemplates: shortcodeTemplates,
+		languages:          languages,
+		now:                time.Now(),
+	}
+	if err := s.loadContent(); err != nil {
+		return nil, err
+	}
+	if err := s.renderPosts(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// check records errors of a build stage. Unless -keep-going is set, it
+// returns all errors recorded so far to stop the build.
+func (s *site) check(err error) error {
+	if err == nil {
+		return nil
+	}
+	if list, ok := err.(errorList); ok {
+		s.errs = append(s.errs, list...)
+	} else {
+		s.errs = append(s.errs, err)
+	}
+	if s.opts.keepGoing {
+		return nil
+	}
+	return s.errs
+}
+
+// skipPage tells whether a page is not to be published yet or anymore,
+// as Hugo does.
+func (s *site) skipPage(metadata gmnhg.Metadata) bool {
+	return (metadata.IsDraft && !s.opts.buildDrafts) ||
+		(metadata.IsFuture(s.now) && !s.opts.buildFuture) ||
+		(metadata.IsExpired(s.now) && !s.opts.buildExpired)
+}
+
+// renderContent renders Markdown from a content file to Gemtext,
+// expanding shortcodes and rewriting links relative to the file. Links
+// in pages with several output files, like paginated indexes, are
+// relative to page.Link instead.
+func (s *site) renderContent(contentPath string, fileContent, content []byte, page gmnhg.Post) ([]byte, error) {
+	relPath := strings.TrimPrefix(contentPath, contentBase)
+	shortcodes := shortcodeRenderer{
+		refs:        refResolver{pages: s.rewriter.pages, baseURL: s.conf.Gmnhg.BaseURL},
+		templates:   s.shortcodeTemplates,
+		contentPath: relPath,
+		page:        page,
+		warn: func(line int, name string) {
+			warnf("%s: line %d: no template for shortcode %q, stripping it", contentPath, line, name)
+		},
+	}
+	// report lines relative to the file start, front matter included
+	firstLine := bytes.Count(fileContent[:len(fileContent)-len(content)], []byte{'\n'}) + 1
+	expanded, err := shortcodes.expand(content, firstLine)
+	if err != nil {
+		e := &buildError{Source: contentPath, Err: err}
+		var scErr *shortcodeError
+		if errors.As(err, &scErr) {
+			e.Line, e.Err = scErr.Line, scErr.Err
+		}
+		var execErr template.ExecError
+		if errors.As(err, &execErr) {
+			e.Template = execErr.Name
+		}
+		return nil, e
+	}
+	options := s.renderOptions
+	if !s.conf.Gmnhg.DisableLinkRewriting {
+		if page.Link != "" {
+			options.RewriteLink = s.rewriter.forOutput(relPath, strings.TrimPrefix(page.Link, "/"))
+		} else {
+			options.RewriteLink = s.rewriter.forPage(relPath)
+		}
+	}
+	gemtext, err := gemini.RenderMarkdownWithOptions(expanded, options)
+	if err != nil {
+		return nil, &buildError{Source: contentPath, Err: err}
+	}
+	gemtext, err = shortcodes.insertGemtext(gemtext)
+	if err != nil {
+		e := &buildError{Source: contentPath, Err: err}
+		var scErr *shortcodeError
+		if errors.As(err, &scErr) {
+			e.Line, e.Err = scErr.Line, scErr.Err
+		}
+		return nil, e
+	}
+	return gemtext, nil
+}
+
+// readSource reads a page content file. ok is false if the page is not
+// to be rendered.
+func (s *site) readSource(contentPath string) (src source, ok bool, err error) {
+	fileContent, err := ioutil.ReadFile(contentPath)
+	if err != nil {
+		return src, false, err
+	}
+	lang, translationPath := s.languageOf(contentPath)
+	if lang == nil {
+		// not in a content dir of any language
+		return src, false, nil
+	}
+	content, metadata, err := gmnhg.ParseMetadataStrict(fileContent)
+	if err != nil {
+		return src, false, frontMatterError(contentPath, err)
+	}
+	// skip drafts, future, and expired posts from rendering
+	if s.skipPage(metadata) {
+		return src, false, nil
+	}
+	// skip headless leaves from rendering
+	isLeafIndex := filepath.Base(translationPath) == "index.md"
+	if isLeafIndex && metadata.IsHeadless {
+		return src, false, nil
+	}
+	return source{
+		path:            contentPath,
+		key:             strings.TrimSuffix(path.Join(lang.prefix, translationPath), ".md") + ".gmi",
+		fileContent:     fileContent,
+		content:         content,
+		metadata:        metadata,
+		isLeafIndex:     isLeafIndex,
+		lang:            lang,
+		translationPath: translationPath,
+		virtualPath:     lang.virtualPath(translationPath),
+	}, true, nil
+}
+
+// loadContent collects pages to be rendered; every page has to be known
+// before rendering so that links between pages can be rewritten.
+func (s *site) loadContent() error {
+	// collect leaf node paths (directories containing an index.* file)
+	if err := filepath.Walk(contentBase, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		// translations of bundles are matched by their virtual paths
+		lang, translationPath := s.languageOf(path)
+		if lang == nil {
+			return nil
+		}
+		if matches := leafIndexRegex.FindStringSubmatch(lang.virtualPath(translationPath)); matches != nil {
+			s.leafIndexPaths = append(s.leafIndexPaths, contentBase+matches[1])
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	var paths []string
+	if err := filepath.Walk(contentBase, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".md") {
+			return nil
+		}
+		lang, translationPath := s.languageOf(path)
+		if lang == nil {
+			return nil
+		}
+		if n := filepath.Base(translationPath); n == hugoIndexMdFilename || n == geminiIndexMdFilename {
+			relPath := strings.TrimPrefix(path, contentBase)
+			dir := strings.TrimSuffix(translationPath, n)
+			output := strings.TrimPrefix(lang.outputPath(dir+indexFilename), "/")
+			s.rewriter.addPage(relPath, output)
+			s.rewriter.addURL(strings.TrimPrefix(lang.virtualPath(translationPath), contentBase), output)
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	}); err != nil {
+		return err
+	}
+	sources := make([]source, len(paths))
+	published := make([]bool, len(paths))
+	// pages failing to load are not published
+	if err := s.check(parallel(s.opts.jobs, len(paths), func(i int) (err error) {
+		sources[i], published[i], err = s.readSource(paths[i])
+		return err
+	})); err != nil {
+		return err
+	}
+	for i, src := range sources {
+		if !published[i] {
+			continue
+		}
+		s.rewriter.addPage(strings.TrimPrefix(src.path, contentBase), src.key)
+		s.rewriter.addURL(strings.TrimPrefix(src.virtualPath, contentBase), src.key)
+		s.sources = append(s.sources, src)
+	}
+	return nil
+}
+
+// renderSource renders a page to Gemtext.
+func (s *site) renderSource(src source) (gmnhg.Post, error) {
+	p := gmnhg.Post{
+		Link:         src.key,
+		Section:      section(src.translationPath),
+		Metadata:     src.metadata,
+		Language:     src.lang.key,
+		LanguageCode: src.lang.code,
+	}
+	content, hasDivider := markSummaryDivider(src.content)
+	gemText, err := s.renderContent(src.path, src.fileContent, content, p)
+	if err != nil {
+		return p, err
+	}
+	var summary []byte
+	if hasDivider {
+		summary, gemText = splitSummary(gemText)
+	}
+	p.Post = gemText
+	p.Summary, p.Truncated = s.summarize(src.metadata, summary, gemText, hasDivider)
+	return p, nil
+}
+
+// renderPosts renders all pages to Gemtext and collects top level posts
+// data.
+func (s *site) renderPosts() error {
+	posts := make([]gmnhg.Post, len(s.sources))
+	failed := make([]bool, len(s.sources))
+	if err := s.check(parallel(s.opts.jobs, len(s.sources), func(i int) (err error) {
+		posts[i], err = s.renderSource(s.sources[i])
+		failed[i] = err != nil
+		return err
+	})); err != nil {
+		return err
+	}
+	// pages that failed to render are dropped with -keep-going
+	sources := s.sources[:0]
+	s.posts = make(map[string]gmnhg.Post)
+	for i, p := range posts {
+		if failed[i] {
+			continue
+		}
+		sources = append(sources, s.sources[i])
+		s.posts[p.Link] = p
+	}
+	s.sources = sources
+	s.linkTranslations()
+	s.groupPosts()
+	return nil
+}
+
+// groupPosts collects posts for every directory index. Every language
+// has its own indexes in its output subdir.
+func (s *site) groupPosts() {
+	s.topLevelPosts = make(map[string]gmnhg.Posts)
+	for _, src := range s.sources {
+		p := s.posts[src.key]
+		matches := pagePathRegex.FindStringSubmatch(contentBase + src.translationPath)
+		if matches == nil {
+			continue
+		}
+		dirs := strings.Split(matches[1], "/")
+		// only include leaf resources pages in leaf index
+		if !src.isLeafIndex && hasSubPath(s.leafIndexPaths, src.virtualPath) {
+			dirname := src.lang.outputPath(matches[1])
+			s.topLevelPosts[dirname] = append(s.topLevelPosts[dirname], p)
+		} else {
+			// include normal pages in all subdirectory indices
+			for i, dir := range dirs {
+				if i > 0 {
+					dirs[i] = dirs[i-1] + "/" + dir
+				}
+			}
+			for _, dir := range dirs {
+				dirname := src.lang.outputPath(dir)
+				s.topLevelPosts[dirname] = append(s.topLevelPosts[dirname], p)
+			}
+			root := src.lang.outputPath("")
+			s.topLevelPosts[root] = append(s.topLevelPosts[root], p)
+		}
+	}
+}
+
+// execute renders a page from the source file with tmpl to dst, which
+// is relative to the output dir.
+func (s *site) execute(tmpl *template.Template, source, dst string, data interface{}) error {
+	buf := bytes.Buffer{}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return templateError(source, tmpl, err)
+	}
+	return s.out.writeFile(path.Join(s.out.path, dst), source, tmpl.Name(), buf.Bytes())
+}
+
+// dirnames returns directories having indexes, sorted.
+func (s *site) dirnames() []string {
+	dirnames := make([]string, 0, len(s.topLevelPosts))
+	for dirname := range s.topLevelPosts {
+		dirnames = append(dirnames, dirname)
+	}
+	sort.Strings(dirnames)
+	return dirnames
+}
+
+// section returns the top-level content dir a content file is in, or
+// an empty string for files in the content dir itself.
+func section(contentPath string) string {
+	contentPath = strings.TrimPrefix(contentPath, "/")
+	if i := strings.IndexByte(contentPath, '/'); i != -1 {
+		return contentPath[:i]
+	}
+	return ""
+}
+
+// templateNames returns names of templates of a kind, like single or
+// list, in the order they're looked up for pages of a section and a
+// type: section/kind, type/kind, and _default/kind.
+func templateNames(section, pageType, kind string) []string {
+	var names []string
+	if section != "" {
+		names = append(names, section+"/"+kind)
+	}
+	if pageType != "" && pageType != section {
+		names = append(names, pageType+"/"+kind)
+	}
+	return append(names, "_default/"+kind)
+}
+
+// writePost renders a page to its output file.
+func (s *site) writePost(src source) error {
+	post := s.posts[src.key]
+	sect := section(src.translationPath)
+	var tmpl = defaultSingleTemplate
+	if pl := post.Metadata.Layout; pl != "" {
+		// layouts are looked up like single templates, and by their
+		// names alone
+		t, ok := lookupTemplate(s.templates, append(templateNames(sect, post.Metadata.Type, pl), pl)...)
+		if !ok {
+			// no point trying to render pages with no layout
+			return nil
+		}
+		tmpl = t
+	} else if t, ok := lookupTemplate(s.templates, append(templateNames(sect, post.Metadata.Type, "single"), defaultPageTemplate)...); ok {
+		tmpl = t
+	}
+	return s.execute(tmpl, src.path, post.Link, &post)
+}
+
+// writeIndex renders the index of a directory other than the root one.
+// Directories with no _index.md get an index with no content.
+func (s *site) writeIndex(dirname string) error {
+	// leaf bundles are pages of their own
+	if hasSubPath(s.leafIndexPaths, path.Join(contentBase, dirname)+"/") {
+		return nil
+	}
+	lang, dir := s.splitDirname(dirname)
+	indexPath := s.findIndexMd(lang, dir)
+	var (
+		fileContent, content []byte
+		metadata             gmnhg.Metadata
+	)
+	if indexPath != "" {
+		var err error
+		if fileContent, err = ioutil.ReadFile(indexPath); err != nil {
+			return err
+		}
+		if content, metadata, err = gmnhg.ParseMetadataStrict(fileContent); err != nil {
+			return frontMatterError(indexPath, err)
+		}
+	}
+	if s.skipPage(metadata) {
+		return nil
+	}
+	tmpl, hasTmpl := lookupTemplate(s.templates, append([]string{"top" + dir}, templateNames(section(dir+"/"), metadata.Type, "list")...)...)
+	if !hasTmpl {
+		if indexPath != "" {
+			warnf("%s: no template for the index of %s, skipping it", indexPath, dirname)
+		} else {
+			warnf("no template for the index of %s, skipping it", dirname)
+		}
+		return nil
+	}
+	posts := s.topLevelPosts[dirname]
+	sc := s.languageConf(lang).templateData()
+	pageLink := func(page int) string { return pagePath(dirname, page) }
+	for _, pager := range gmnhg.Paginate(posts, s.conf.Gmnhg.Paginate, pageLink) {
+		link := pageLink(pager.PageNumber)
+		// links in the content are relative to every page of the index
+		var gemtext []byte
+		if indexPath != "" {
+			var err error
+			if gemtext, err = s.renderContent(indexPath, fileContent, content, gmnhg.Post{
+				Link:     link,
+				Metadata: metadata,
+			}); err != nil {
+				return err
+			}
+		}
+		cnt := map[string]interface{}{
+			"Posts":     posts,
+			"Paginator": pager,
+			"Dirname":   dirname,
+			"Link":      link,
+			"Content":   gemtext,
+			"Site":      sc,
+			"Metadata":  metadata,
+		}
+		if err := s.execute(tmpl, indexPath, link, cnt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRootIndex renders the top-level index of a language.
+func (s *site) writeRootIndex(lang *language) error {
+	var indexTmpl = defaultIndexTemplate
+	if t, hasIndexTmpl := s.templates["index"]; hasIndexTmpl {
+		indexTmpl = t
+	}
+	indexPath := s.findIndexMd(lang, "/")
+	indexContent, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		return fmt.Errorf("cannot read the site index: %w", err)
+	}
+	content, metadata, err := gmnhg.ParseMetadataStrict(indexContent)
+	if err != nil {
+		return frontMatterError(indexPath, err)
+	}
+	root := lang.outputPath("")
+	// directories of other languages are left out, and those of the
+	// language are listed as if it had the entire site to itself
+	topLevelPosts := make(map[string]gmnhg.Posts)
+	for dirname, posts := range s.topLevelPosts {
+		if l, dir := s.splitDirname(dirname); l == lang {
+			topLevelPosts[dir] = posts
+		}
+	}
+	sc := s.languageConf(lang).templateData()
+	rootPageLink := func(page int) string { return pagePath(root, page) }
+	for _, pager := range gmnhg.Paginate(s.topLevelPosts[root], s.conf.Gmnhg.Paginate, rootPageLink) {
+		link := rootPageLink(pager.PageNumber)
+		// links in the content are relative to every page of the index
+		gemtext, err := s.renderContent(indexPath, indexContent, content, gmnhg.Post{
+			Link:         link,
+			Metadata:     metadata,
+			Language:     lang.key,
+			LanguageCode: lang.code,
+		})
+		if err != nil {
+			return err
+		}
+		cnt := map[string]interface{}{
+			"Posts":     topLevelPosts,
+			"Paginator": pager,
+			"Dirname":   root,
+			"Link":      link,
+			"Content":   gemtext,
+			"Site":      sc,
+			"Metadata":  metadata,
+		}
+		if err := s.execute(indexTmpl, indexPath, link, cnt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeArchive renders the list of all pages of a language grouped by
+// year with archive.gotmpl, unless there's a content page with the same
+// output path.
+func (s *site) writeArchive(lang *language) error {
+	if s.conf.Gmnhg.DisableArchive {
+		return nil
+	}
+	link := lang.outputPath(archiveFilename)
+	if _, isPage := s.posts[strings.TrimPrefix(link, "/")]; isPage {
+		return nil
+	}
+	tmpl := defaultArchiveTemplate
+	if t, hasTmpl := s.templates["archive"]; hasTmpl {
+		tmpl = t
+	}
+	cnt := map[string]interface{}{
+		"Posts":   s.allPosts(lang),
+		"Dirname": lang.outputPath(""),
+		"Link":    link,
+		"Site":    s.languageConf(lang).templateData(),
+	}
+	return s.execute(tmpl, "", link, cnt)
+}
+
+// writeFeed renders the RSS feed of a directory.
+func (s *site) writeFeed(dirname string) error {
+	// do not render RSS for leaf paths
+	if hasSubPath(s.leafIndexPaths, path.Join(contentBase, dirname)+"/") {
+		return nil
+	}
+	lang, dir := s.splitDirname(dirname)
+	tmpl, hasTmpl := s.templates["rss"+dir]
+	if !hasTmpl {
+		if rootTmpl, hasTmpl := s.templates["rss"]; dir == "/" && hasTmpl {
+			tmpl = rootTmpl
+		} else {
+			tmpl = s.rssTemplate
+		}
+	}
+	cnt := map[string]interface{}{
+		"Posts":   s.topLevelPosts[dirname],
+		"Dirname": dirname,
+		"Link":    path.Join(dirname, rssFilename),
+		"Site":    s.languageConf(lang).templateData(),
+	}
+	return s.execute(tmpl, "", path.Join(dirname, rssFilename), cnt)
+}
+
+// writeTaxonomies renders taxonomy pages of a language.
+func (s *site) writeTaxonomies(lang *language) error {
+	return renderTaxonomies(s.out, lang.prefix, s.languageConf(lang), s.templates, s.allPosts(lang))
+}
+
+func (s *site) aliasTemplate() *template.Template {
+	if tmpl, ok := s.templates["alias"]; ok {
+		return tmpl
+	}
+	return defaultAliasTemplate
+}
+
+// writeAll renders the entire site to the output dir.
+func (s *site) writeAll() error {
+	// render posts to files
+	if err := s.check(parallel(s.opts.jobs, len(s.sources), func(i int) error {
+		return s.writePost(s.sources[i])
+	})); err != nil {
+		return err
+	}
+	// render indexes for top-level dirs, the main index, and RSS/Atom
+	// feeds for all of them
+	dirnames := s.dirnames()
+	if err := s.check(parallel(s.opts.jobs, len(dirnames)*2, func(i int) error {
+		dirname := dirnames[i/2]
+		lang, dir := s.splitDirname(dirname)
+		switch {
+		case i%2 == 1:
+			return s.writeFeed(dirname)
+		case dir == "/":
+			return s.writeRootIndex(lang)
+		default:
+			return s.writeIndex(dirname)
+		}
+	})); err != nil {
+		return err
+	}
+
+	// render taxonomy pages for tags, categories, etc, the archive, and
+	// stub pages for aliases of moved content in every language
+	s.redirects = nil
+	for _, lang := range s.languages {
+		if err := s.check(s.writeTaxonomies(lang)); err != nil {
+			return err
+		}
+		if err := s.check(s.writeArchive(lang)); err != nil {
+			return err
+		}
+		redirects, err := renderAliases(s.out, lang.prefix, s.languageConf(lang), s.aliasTemplate(), s.allPosts(lang))
+		if err := s.check(err); err != nil {
+			return err
+		}
+		s.redirects = append(s.redirects, redirects...)
+	}
+	if s.opts.redirectsFile != "" {
+		if err := s.check(writeRedirects(s.out, s.opts.redirectsFile, s.redirects)); err != nil {
+			return err
+		}
+	}
+
+	// copy page resources and static files to output dir unmodified
+	var copies [][2]string
+	if err := filepath.Walk(contentBase, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(info.Name(), ".md") {
+			return nil
+		}
+		for _, dst := range s.resourcePaths(p) {
+			copies = append(copies, [2]string{path.Join(s.out.path, dst), p})
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := filepath.Walk(staticBase, func(p string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		copies = append(copies, [2]string{path.Join(s.out.path, strings.TrimPrefix(p, staticBase)), p})
+		return nil
+	}); err != nil {
+		return err
+	}
+	return s.check(parallel(s.opts.jobs, len(copies), func(i int) error {
+		return s.out.copyFile(copies[i][0], copies[i][1])
+	}))
+}
+
+// buildSite renders the site in the current directory from scratch.
+// With -keep-going, the site is returned along with errors of all files
+// that failed to render.
+func buildSite(opts buildOptions) (*site, error) {
+	s, err := loadSite(opts)
+	if err != nil {
+		return nil, err
+	}
+	if s.out, err = prepareOutputDir(opts.outputDir, opts.force, opts.sync, opts.dryRun); err != nil {
+		return nil, err
+	}
+	if err := s.writeAll(); err != nil {
+		return nil, err
+	}
+	var manifest []byte
+	if opts.manifestFile != "" {
+		if manifest, err = s.out.manifest(); err != nil {
+			return nil, err
+		}
+		if err := s.out.writeFile(opts.manifestFile, "", "", manifest); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.out.removeStale(); err != nil {
+		return nil, err
+	}
+	if opts.dryRun {
+		if err := s.out.reportChanges(os.Stdout); err != nil {
+			return nil, err
+		}
+		// the manifest describes the build that would be made, and is
+		// printed as a dry run writes nothing
+		if manifest != nil {
+			if _, err := os.Stdout.Write(manifest); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(s.errs) > 0 {
+		return s, s.errs
+	}
+	return s, nil
+}
@@ -0,0 +1,353 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/tdemin/gmnhg/internal/gmnhg"
+)
+
+// testSite is a small Hugo site with a few sections, tags, and an alias.
+var testSite = map[string]string{
+	"config.toml":                  "baseURL = \"https://example.com/\"\ntitle = \"Test\"\n\n[gmnhg]\nbaseURL = \"gemini://example.com/\"\n",
+	"content/_index.md":            "---\ntitle: Home\n---\nWelcome.\n",
+	"content/about.md":             "---\ntitle: About\ndate: 2021-01-01\n---\nAbout [the first post](posts/p1.md).\n",
+	"content/posts/_index.md":      "---\ntitle: Posts\n---\n",
+	"content/posts/p1.md":          "---\ntitle: First\ndate: 2021-01-02\ntags: [go, gemini]\naliases: [/old/p1/]\n---\nThe first post.\n",
+	"content/posts/p2.md":          "---\ntitle: Second\ndate: 2021-01-03\ntags: [go]\n---\nThe second post.\n",
+	"content/posts/p3/index.md":    "---\ntitle: Third\ndate: 2021-01-04\n---\nThe third post with a ![picture](image.png).\n",
+	"content/posts/p3/image.png":   "\x89PNG\r\n\x1a\n",
+	"content/notes/n1.md":          "---\ntitle: Note\ndate: 2021-02-01\ncategories: [misc]\n---\nA note.\n",
+	"gmnhg/_default/single.gotmpl": "# {{ .Metadata.Title }}\n\n{{ printf \"%s\" .Post }}",
+	"gmnhg/_default/list.gotmpl":   "# {{ .Dirname }}\n{{ range .Posts }}\n=> /{{ .Link }} {{ .Metadata.Title }}{{ end }}\n",
+	"static/robots.txt":            "User-agent: *\n",
+}
+
+// chdirSite writes files of a site to a temporary dir, and changes the
+// working dir to it until the test ends.
+func chdirSite(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeTree(t, dir, files)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+	return dir
+}
+
+// readTree returns contents of files in dir by their paths.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		contents, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		files[filepath.ToSlash(rel)] = string(contents)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestSkipPage(t *testing.T) {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	draft := gmnhg.Metadata{IsDraft: true}
+	future := gmnhg.Metadata{PublishDate: now.AddDate(0, 0, 1)}
+	expired := gmnhg.Metadata{ExpiryDate: now.AddDate(0, 0, -1)}
+	published := gmnhg.Metadata{Date: now.AddDate(0, 0, -1), ExpiryDate: now.AddDate(0, 0, 1)}
+	tests := []struct {
+		name     string
+		opts     buildOptions
+		metadata gmnhg.Metadata
+		want     bool
+	}{
+		{"published", buildOptions{}, published, false},
+		{"draft", buildOptions{}, draft, true},
+		{"draft with -buildDrafts", buildOptions{buildDrafts: true}, draft, false},
+		{"future", buildOptions{}, future, true},
+		{"future with -buildFuture", buildOptions{buildFuture: true}, future, false},
+		{"future with -buildDrafts", buildOptions{buildDrafts: true}, future, true},
+		{"expired", buildOptions{}, expired, true},
+		{"expired with -buildExpired", buildOptions{buildExpired: true}, expired, false},
+	}
+	for _, test := range tests {
+		s := &site{opts: test.opts, now: now}
+		if got := s.skipPage(test.metadata); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFeedLastBuildDate(t *testing.T) {
+	dir := chdirSite(t, testSite)
+	opts := buildOptions{outputDir: "output", jobs: 1}
+	if _, err := buildSite(opts); err != nil {
+		t.Fatal(err)
+	}
+	first := readTree(t, filepath.Join(dir, "output"))
+	want := "<lastBuildDate>Mon, 04 Jan 2021 00:00:00 +0000</lastBuildDate>"
+	if feed := first["posts/rss.xml"]; !strings.Contains(feed, want) {
+		t.Errorf("posts/rss.xml: missing %q in %q", want, feed)
+	}
+	opts.sync = true
+	if _, err := buildSite(opts); err != nil {
+		t.Fatal(err)
+	}
+	second := readTree(t, filepath.Join(dir, "output"))
+	for name, contents := range first {
+		if second[name] != contents {
+			t.Errorf("%s: changed between builds", name)
+		}
+	}
+}
+
+func TestJobs(t *testing.T) {
+	dir := chdirSite(t, testSite)
+	for outputDir, jobs := range map[string]int{"j1": 1, "j8": 8} {
+		if _, err := buildSite(buildOptions{outputDir: outputDir, jobs: jobs}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	serial := readTree(t, filepath.Join(dir, "j1"))
+	parallel := readTree(t, filepath.Join(dir, "j8"))
+	if len(serial) != len(parallel) {
+		t.Errorf("got %d files with -j 8, want %d", len(parallel), len(serial))
+	}
+	for name, contents := range serial {
+		if parallel[name] != contents {
+			t.Errorf("%s: got %q with -j 8, want %q", name, parallel[name], contents)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	dir := chdirSite(t, testSite)
+	if _, err := buildSite(buildOptions{outputDir: "output", jobs: 1, manifestFile: "manifest.json"}); err != nil {
+		t.Fatal(err)
+	}
+	built := readTree(t, dir)
+	// a dry run prints changes and the manifest to stdout
+	stdout, err := ioutil.TempFile(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	os.Stdout, stdout = stdout, os.Stdout
+	_, err = buildSite(buildOptions{outputDir: "output", jobs: 1, dryRun: true, manifestFile: "dry.json"})
+	os.Stdout, stdout = stdout, os.Stdout
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, err := ioutil.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(printed), built["manifest.json"]; got != want {
+		t.Errorf("got %q printed, want only the manifest %q", got, want)
+	}
+	after := readTree(t, dir)
+	if len(after) != len(built) {
+		t.Errorf("got %d files after the dry run, want %d", len(after), len(built))
+	}
+	for name, contents := range built {
+		if after[name] != contents {
+			t.Errorf("%s: changed by the dry run", name)
+		}
+	}
+}
+
+func TestTemplateNames(t *testing.T) {
+	tests := []struct {
+		name                    string
+		section, pageType, kind string
+		want                    []string
+	}{
+		{"no section", "", "", "single", []string{"_default/single"}},
+		{"section", "posts", "", "single", []string{"posts/single", "_default/single"}},
+		{"type", "", "note", "single", []string{"note/single", "_default/single"}},
+		{"section and type", "posts", "note", "single", []string{"posts/single", "note/single", "_default/single"}},
+		{"type of the section", "posts", "posts", "single", []string{"posts/single", "_default/single"}},
+		{"layout", "posts", "note", "wide", []string{"posts/wide", "note/wide", "_default/wide"}},
+		{"list", "posts", "note", "list", []string{"posts/list", "note/list", "_default/list"}},
+	}
+	for _, test := range tests {
+		if got := templateNames(test.section, test.pageType, test.kind); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLookupTemplate(t *testing.T) {
+	templates := make(map[string]*template.Template)
+	for _, name := range []string{"posts/single", "note/single", "_default/single", "note/wide", "wide", "_default/list", "top/posts"} {
+		templates[name] = template.New(name)
+	}
+	tests := []struct {
+		name  string
+		names []string
+		want  string
+	}{
+		{"section first", append(templateNames("posts", "note", "single"), defaultPageTemplate), "posts/single"},
+		{"type before default", append(templateNames("notes", "note", "single"), defaultPageTemplate), "note/single"},
+		{"default", append(templateNames("notes", "", "single"), defaultPageTemplate), "_default/single"},
+		{"layout of type", append(templateNames("posts", "note", "wide"), "wide"), "note/wide"},
+		{"layout by name", append(templateNames("posts", "", "wide"), "wide"), "wide"},
+		{"missing layout", append(templateNames("posts", "", "narrow"), "narrow"), ""},
+		{"top list", append([]string{"top/posts"}, templateNames("posts", "", "list")...), "top/posts"},
+		{"default list", append([]string{"top/notes"}, templateNames("notes", "", "list")...), "_default/list"},
+	}
+	for _, test := range tests {
+		got := ""
+		if tmpl, ok := lookupTemplate(templates, test.names...); ok {
+			got = tmpl.Name()
+		}
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"gmnhg/partials/footer.gotmpl": "footer",
+		"gmnhg/partials/nested.gotmpl": "nested {{ template \"partials/footer\" . }}",
+		"gmnhg/_default/baseof.gotmpl": "head {{ block \"main\" . }}default{{ end }} tail",
+		"gmnhg/_default/single.gotmpl": "body {{ template \"partials/nested\" . }}",
+		"gmnhg/_default/list.gotmpl":   "{{ define \"main\" }}list{{ end }}",
+		"gmnhg/posts/single.gotmpl":    "{{ define \"main\" }}post {{ template \"partials/footer\" . }}{{ end }}",
+		"gmnhg/notes/baseof.gotmpl":    "notes {{ block \"main\" . }}default{{ end }}",
+		"gmnhg/notes/single.gotmpl":    "{{ define \"main\" }}note{{ end }}",
+		"gmnhg/notes/list.gotmpl":      "{{ define \"other\" }}other{{ end }}",
+	})
+	templates, err := loadTemplates(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"_default/single", "body nested footer"},
+		{"_default/list", "head list tail"},
+		{"posts/single", "head post footer tail"},
+		{"notes/single", "notes note"},
+		{"notes/list", "notes default"},
+	}
+	for _, test := range tests {
+		tmpl, ok := templates[test.name]
+		if !ok {
+			t.Errorf("%s: not loaded", test.name)
+			continue
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, nil); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if got := buf.String(); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+	// partials and baseof templates are only used by the other ones
+	for _, name := range []string{"partials/footer", "_default/baseof", "notes/baseof"} {
+		if _, ok := templates[name]; ok {
+			t.Errorf("%s: loaded as a template of its own", name)
+		}
+	}
+}
+
+func TestUndefinedTemplates(t *testing.T) {
+	chdirSite(t, map[string]string{
+		"gmnhg/partials/header.gotmpl": "{{ template \"partials/missing\" . }}",
+		"gmnhg/_default/single.gotmpl": "# {{ .Metadata.Title }}\n{{ template \"partials/footer\" . }}",
+	})
+	_, err := loadTemplates(nil)
+	list, ok := err.(errorList)
+	if !ok || len(list) != 2 {
+		t.Fatalf("got %v, want 2 errors", err)
+	}
+	tests := []struct {
+		source, partial string
+	}{
+		{"gmnhg/partials/header.gotmpl:1: ", "partials/missing"},
+		{"gmnhg/_default/single.gotmpl:2: ", "partials/footer"},
+	}
+	for _, test := range tests {
+		found := false
+		for _, err := range list {
+			msg := err.Error()
+			found = found || strings.HasPrefix(msg, test.source) && strings.Contains(msg, fmt.Sprintf("undefined template %q", test.partial))
+		}
+		if !found {
+			t.Errorf("got %q, want an error at %s about %s", list.Error(), test.source, test.partial)
+		}
+	}
+}
+
+func TestIndexWithoutIndexMd(t *testing.T) {
+	dir := chdirSite(t, testSite)
+	if _, err := buildSite(buildOptions{outputDir: "output", jobs: 1}); err != nil {
+		t.Fatal(err)
+	}
+	output := readTree(t, filepath.Join(dir, "output"))
+	tests := []struct {
+		file, want string
+	}{
+		// content/notes/ has no _index.md
+		{"notes/index.gmi", "# /notes\n\n=> /notes/n1.gmi Note\n"},
+		// leaf bundles are not indexes
+		{"posts/p3/index.gmi", "# Third\n\nThe third post with a picture.\n\n=> image.png picture\n"},
+	}
+	for _, test := range tests {
+		if got := output[test.file]; got != test.want {
+			t.Errorf("%s: got %q, want %q", test.file, got, test.want)
+		}
+	}
+
+	// with no list template, the index is skipped
+	if err := os.Remove(filepath.Join(dir, "gmnhg", "_default", "list.gotmpl")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildSite(buildOptions{outputDir: "output", jobs: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "output", "notes", "index.gmi")); !os.IsNotExist(err) {
+		t.Errorf("notes/index.gmi: rendered with no template")
+	}
+}
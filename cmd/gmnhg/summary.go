@@ -0,0 +1,222 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+
+	"github.com/tdemin/gmnhg/internal/gmnhg"
+)
+
+// Hugo summaries are 70 words long unless summaryLength is set
+const defaultSummaryLength = 70
+
+const (
+	// summaryDivider separates the summary from the rest of the content
+	summaryDivider = "<!--more-->"
+	// placeholder of the divider, as long as the divider itself so that
+	// line numbers in errors stay correct; Markdown rendering leaves it
+	// intact
+	summaryPlaceholder = "GMNHGSUMEND"
+)
+
+// markSummaryDivider replaces the first summary divider in Markdown
+// content with a placeholder to be found in the rendered Gemtext,
+// telling whether there's a divider. Dividers in code are left alone.
+func markSummaryDivider(content []byte) ([]byte, bool) {
+	i := findSummaryDivider(content)
+	if i == -1 {
+		return content, false
+	}
+	marked := make([]byte, 0, len(content))
+	marked = append(marked, content[:i]...)
+	marked = append(marked, summaryPlaceholder...)
+	return append(marked, content[i+len(summaryDivider):]...), true
+}
+
+// findSummaryDivider returns the offset of the first summary divider in
+// Markdown content outside of fenced and indented code blocks and code
+// spans, or -1 if there's none.
+func findSummaryDivider(content []byte) int {
+	var (
+		// opening fence of the current fenced code block
+		fence []byte
+		// indented code blocks can't interrupt paragraphs
+		prevBlank, indented = true, false
+		offset              int
+	)
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		start := offset
+		offset += len(line)
+		line = bytes.TrimRight(line, "\r\n")
+		blank := len(bytes.TrimSpace(line)) == 0
+		if fence != nil {
+			if isClosingFence(line, fence) {
+				fence = nil
+			}
+			continue
+		}
+		if fence = openingFence(line); fence != nil {
+			indented = false
+			continue
+		}
+		if !blank && (bytes.HasPrefix(line, []byte("    ")) || bytes.HasPrefix(line, []byte("\t"))) && (prevBlank || indented) {
+			indented, prevBlank = true, false
+			continue
+		}
+		if !blank {
+			indented = false
+		}
+		prevBlank = blank
+		if i := indexOutsideCodeSpans(line, []byte(summaryDivider)); i != -1 {
+			return start + i
+		}
+	}
+	return -1
+}
+
+// openingFence returns the fence opening a fenced code block on line,
+// or nil if the line opens none.
+func openingFence(line []byte) []byte {
+	trimmed := bytes.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return nil
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == trimmed[0] {
+		n++
+	}
+	// info strings of backtick fences can't contain backticks
+	if n < 3 || (trimmed[0] == '`' && bytes.IndexByte(trimmed[n:], '`') != -1) {
+		return nil
+	}
+	return trimmed[:n]
+}
+
+// isClosingFence tells whether line closes a code block opened with
+// fence.
+func isClosingFence(line, fence []byte) bool {
+	trimmed := bytes.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return false
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == fence[0] {
+		n++
+	}
+	return n >= len(fence) && len(bytes.TrimSpace(trimmed[n:])) == 0
+}
+
+// indexOutsideCodeSpans returns the index of the first s in line that
+// is not inside a code span, or -1 if there's none.
+func indexOutsideCodeSpans(line, s []byte) int {
+	for i := 0; i < len(line); {
+		if line[i] != '`' {
+			if bytes.HasPrefix(line[i:], s) {
+				return i
+			}
+			i++
+			continue
+		}
+		n := backtickRun(line[i:])
+		// a code span ends with a backtick run of the same length, and
+		// unmatched backticks are literal
+		end := -1
+		for j := i + n; j < len(line); {
+			if m := backtickRun(line[j:]); m == n {
+				end = j + m
+				break
+			} else if m > 0 {
+				j += m
+			} else {
+				j++
+			}
+		}
+		if end == -1 {
+			i += n
+		} else {
+			i = end
+		}
+	}
+	return -1
+}
+
+func backtickRun(text []byte) int {
+	n := 0
+	for n < len(text) && text[n] == '`' {
+		n++
+	}
+	return n
+}
+
+// splitSummary returns the Gemtext before the divider placeholder, and
+// the entire Gemtext with the placeholder removed.
+func splitSummary(gemtext []byte) (summary, full []byte) {
+	i := bytes.Index(gemtext, []byte(summaryPlaceholder))
+	if i == -1 {
+		return nil, gemtext
+	}
+	before, rest := gemtext[:i], gemtext[i+len(summaryPlaceholder):]
+	if i == 0 || gemtext[i-1] == '\n' {
+		// a divider on its own makes a paragraph, which goes away
+		// entirely
+		switch {
+		case bytes.HasPrefix(rest, []byte("\n\n")):
+			rest = rest[2:]
+		case bytes.HasPrefix(rest, []byte("\n")):
+			rest = rest[1:]
+		}
+	} else {
+		// whitespace around an inline divider collapses to a single
+		// space, or to none at the end of the line
+		trimmedBefore := bytes.TrimRight(before, " \t")
+		trimmedRest := bytes.TrimLeft(rest, " \t")
+		if len(trimmedBefore) < len(before) || len(trimmedRest) < len(rest) {
+			before, rest = trimmedBefore, trimmedRest
+			if len(rest) > 0 && rest[0] != '\n' {
+				rest = append([]byte(" "), rest...)
+			}
+		}
+	}
+	if len(rest) == 0 {
+		// a divider at the end leaves no extra blank line behind
+		if before = bytes.TrimRight(before, "\n"); len(before) > 0 {
+			rest = []byte("\n")
+		}
+	}
+	full = make([]byte, 0, len(gemtext))
+	full = append(full, before...)
+	return bytes.TrimSpace(gemtext[:i]), append(full, rest...)
+}
+
+// summarize returns the summary of a page, and whether the page has more
+// to it, preferring the summary set in front matter to the text before
+// the divider, and the latter to the first words of the page.
+func (s *site) summarize(metadata gmnhg.Metadata, summary, gemtext []byte, hasDivider bool) (string, bool) {
+	switch {
+	case metadata.Summary != "":
+		// the summary is plain text, and so is what it's compared to
+		summaryText := gmnhg.PlainText([]byte(metadata.Summary))
+		return metadata.Summary, len(gmnhg.PlainText(gemtext)) > len(summaryText)
+	case hasDivider:
+		return gmnhg.PlainText(summary), len(bytes.TrimSpace(gemtext)) > len(summary)
+	}
+	length := s.conf.SummaryLength
+	if length <= 0 {
+		length = defaultSummaryLength
+	}
+	return gmnhg.Summarize(gemtext, length)
+}
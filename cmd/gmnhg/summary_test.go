@@ -0,0 +1,103 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/tdemin/gmnhg/internal/gmnhg"
+)
+
+func TestMarkSummaryDivider(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		found   bool
+	}{
+		{"no divider", "text\n", "text\n", false},
+		{"paragraph", "a\n\n<!--more-->\n\nb", "a\n\nGMNHGSUMEND\n\nb", true},
+		{"first divider only", "<!--more--> <!--more-->", "GMNHGSUMEND <!--more-->", true},
+		{"fenced code", "```\n<!--more-->\n```\n", "```\n<!--more-->\n```\n", false},
+		{"longer fence", "~~~~\n<!--more-->\n~~~\n~~~~\n<!--more-->", "~~~~\n<!--more-->\n~~~\n~~~~\nGMNHGSUMEND", true},
+		{"unclosed fence", "```go\n<!--more-->\n", "```go\n<!--more-->\n", false},
+		{"indented code", "text\n\n    <!--more-->\n\n\tcode\n", "text\n\n    <!--more-->\n\n\tcode\n", false},
+		{"paragraph continuation", "text\n    <!--more-->", "text\n    GMNHGSUMEND", true},
+		{"code span", "`<!--more-->` and <!--more-->", "`<!--more-->` and GMNHGSUMEND", true},
+		{"double backtick code span", "``a ` <!--more-->`` x", "``a ` <!--more-->`` x", false},
+		{"unmatched backtick", "` <!--more-->", "` GMNHGSUMEND", true},
+	}
+	for _, test := range tests {
+		got, found := markSummaryDivider([]byte(test.content))
+		if string(got) != test.want || found != test.found {
+			t.Errorf("%s: got %q, %t, want %q, %t", test.name, got, found, test.want, test.found)
+		}
+	}
+}
+
+func TestSplitSummary(t *testing.T) {
+	tests := []struct {
+		name          string
+		gemtext       string
+		summary, full string
+	}{
+		{"no divider", "a\n\nb\n", "", "a\n\nb\n"},
+		{"paragraph", "a\n\nGMNHGSUMEND\n\nb\n", "a", "a\n\nb\n"},
+		{"inline", "one GMNHGSUMENDtwo\n", "one", "one two\n"},
+		{"inline between spaces", "Post 1 text GMNHGSUMEND rest.\n", "Post 1 text", "Post 1 text rest.\n"},
+		{"inline between several spaces", "a\t GMNHGSUMEND  b\n", "a", "a b\n"},
+		{"inline at the end of a line", "a GMNHGSUMEND\nb\n", "a", "a\nb\n"},
+		{"inline between words", "aGMNHGSUMENDb\n", "a", "ab\n"},
+		{"at the end", "a\n\nGMNHGSUMEND\n", "a", "a\n"},
+		{"at the start", "GMNHGSUMEND\n\nb\n", "", "b\n"},
+	}
+	for _, test := range tests {
+		summary, full := splitSummary([]byte(test.gemtext))
+		if string(summary) != test.summary || string(full) != test.full {
+			t.Errorf("%s: got %q, %q, want %q, %q", test.name, summary, full, test.summary, test.full)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name          string
+		summaryLength int
+		metadata      gmnhg.Metadata
+		summary       string
+		gemtext       string
+		hasDivider    bool
+		want          string
+		truncated     bool
+	}{
+		{"front matter", 0, gmnhg.Metadata{Summary: "Set."}, "", "text\n", false, "Set.", false},
+		{"front matter shorter than the page", 0, gmnhg.Metadata{Summary: "Set."}, "", "Some more text.\n", false, "Set.", true},
+		{"front matter of the entire page", 0, gmnhg.Metadata{Summary: "The text\nof the page."}, "", "# The text\n\nof the page.\n", false, "The text\nof the page.", false},
+		{"front matter of an empty page", 0, gmnhg.Metadata{Summary: "Set."}, "", "", false, "Set.", false},
+		{"front matter over the divider", 0, gmnhg.Metadata{Summary: "Set."}, "a", "a\n\nmore text\n", true, "Set.", true},
+		{"divider", 0, gmnhg.Metadata{}, "# Intro\n\n* item text", "# Intro\n\n* item text\n\nmore\n", true, "Intro item text", true},
+		{"divider at the end", 0, gmnhg.Metadata{}, "text", "text\n", true, "text", false},
+		{"summary length", 3, gmnhg.Metadata{}, "", "one two three four\n", false, "one two three", true},
+		{"default summary length", 0, gmnhg.Metadata{}, "", "one two three four\n", false, "one two three four", false},
+	}
+	for _, test := range tests {
+		s := &site{conf: SiteConfig{SummaryLength: test.summaryLength}}
+		summary, truncated := s.summarize(test.metadata, []byte(test.summary), []byte(test.gemtext), test.hasDivider)
+		if summary != test.want || truncated != test.truncated {
+			t.Errorf("%s: got %q, %t, want %q, %t", test.name, summary, truncated, test.want, test.truncated)
+		}
+	}
+}
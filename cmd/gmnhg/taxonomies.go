@@ -0,0 +1,122 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"text/template"
+
+	"github.com/tdemin/gmnhg/internal/gmnhg"
+)
+
+// Hugo taxonomies enabled when the site config has none
+var defaultTaxonomies = map[string]string{
+	"tag":      "tags",
+	"category": "categories",
+}
+
+// lookupTemplate returns the first template found by names.
+func lookupTemplate(templates map[string]*template.Template, names ...string) (*template.Template, bool) {
+	for _, name := range names {
+		if tmpl, ok := templates[name]; ok {
+			return tmpl, true
+		}
+	}
+	return nil, false
+}
+
+func executeToFile(out *outputDir, tmpl *template.Template, dst string, data interface{}) error {
+	buf := bytes.Buffer{}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		// taxonomy pages have no content file, so errors point to the
+		// page being rendered instead
+		rel, _ := out.relPath(dst)
+		return templateError(rel, tmpl, err)
+	}
+	return out.writeFile(dst, "", tmpl.Name(), buf.Bytes())
+}
+
+// renderTaxonomies renders a list of terms for every taxonomy, and a
+// list of posts along with an RSS feed for every term, to the prefix
+// subdir of the output dir.
+func renderTaxonomies(out *outputDir, prefix string, siteConf SiteConfig, templates map[string]*template.Template, posts gmnhg.Posts) error {
+	taxonomies := siteConf.Taxonomies
+	if taxonomies == nil {
+		taxonomies = defaultTaxonomies
+	}
+	plurals := make([]string, 0, len(taxonomies))
+	for _, plural := range taxonomies {
+		plurals = append(plurals, plural)
+	}
+	sort.Strings(plurals)
+	sc := siteConf.templateData()
+	for _, taxonomy := range plurals {
+		terms := gmnhg.CollectTerms(posts, taxonomy)
+		if len(terms) == 0 {
+			continue
+		}
+		for i := range terms {
+			terms[i].Link = path.Join("/", prefix, taxonomy, terms[i].Slug, indexFilename)
+		}
+		dirname := path.Join("/", prefix, taxonomy)
+		tmpl, ok := lookupTemplate(templates, "taxonomy/"+taxonomy, "_default/taxonomy")
+		if !ok {
+			tmpl = defaultTaxonomyTemplate
+		}
+		if err := executeToFile(out, tmpl, path.Join(out.path, dirname, indexFilename), map[string]interface{}{
+			"Taxonomy": taxonomy,
+			"Terms":    terms,
+			"Dirname":  dirname,
+			"Link":     path.Join(dirname, indexFilename),
+			"Site":     sc,
+		}); err != nil {
+			return fmt.Errorf("taxonomy %s: %w", taxonomy, err)
+		}
+		termTmpl, ok := lookupTemplate(templates, "term/"+taxonomy, "_default/term")
+		if !ok {
+			termTmpl = defaultTermTemplate
+		}
+		for _, term := range terms {
+			dirname := path.Join("/", prefix, taxonomy, term.Slug)
+			if err := executeToFile(out, termTmpl, path.Join(out.path, dirname, indexFilename), map[string]interface{}{
+				"Taxonomy": taxonomy,
+				"Term":     term,
+				"Posts":    term.Posts,
+				"Dirname":  dirname,
+				"Link":     term.Link,
+				"Site":     sc,
+			}); err != nil {
+				return fmt.Errorf("%s term %q: %w", taxonomy, term.Name, err)
+			}
+			rssTmpl, ok := lookupTemplate(templates, path.Join("rss", taxonomy, term.Slug), "rss/"+taxonomy, "_default/rss")
+			if !ok {
+				rssTmpl = defaultRssTemplate
+			}
+			if err := executeToFile(out, rssTmpl, path.Join(out.path, dirname, rssFilename), map[string]interface{}{
+				"Posts":   term.Posts,
+				"Dirname": dirname,
+				"Link":    path.Join(dirname, rssFilename),
+				"Site":    sc,
+			}); err != nil {
+				return fmt.Errorf("%s term %q feed: %w", taxonomy, term.Name, err)
+			}
+		}
+	}
+	return nil
+}
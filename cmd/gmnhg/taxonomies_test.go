@@ -0,0 +1,83 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderTaxonomies(t *testing.T) {
+	dir := chdirSite(t, testSite)
+	if _, err := buildSite(buildOptions{outputDir: "output", jobs: 1}); err != nil {
+		t.Fatal(err)
+	}
+	output := readTree(t, filepath.Join(dir, "output"))
+	tests := []struct {
+		file, want string
+	}{
+		{"tags/index.gmi", "# Tags\n\n=> /tags/gemini/index.gmi gemini (1)\n=> /tags/go/index.gmi go (2)\n"},
+		{"tags/go/index.gmi", "# Tags: go\n\n=> /posts/p2.gmi 2021-01-03 - Second\n=> /posts/p1.gmi 2021-01-02 - First\n"},
+		{"tags/gemini/index.gmi", "# Tags: gemini\n\n=> /posts/p1.gmi 2021-01-02 - First\n"},
+		{"categories/index.gmi", "# Categories\n\n=> /categories/misc/index.gmi misc (1)\n"},
+		{"categories/misc/index.gmi", "# Categories: misc\n\n=> /notes/n1.gmi 2021-02-01 - Note\n"},
+	}
+	for _, test := range tests {
+		if got := output[test.file]; got != test.want {
+			t.Errorf("%s: got %q, want %q", test.file, got, test.want)
+		}
+	}
+
+	// term feeds list the posts of the term, newest first
+	feed := output["tags/go/rss.xml"]
+	for _, want := range []string{
+		"<link>gemini://example.com/tags/go</link>",
+		"<lastBuildDate>Sun, 03 Jan 2021 00:00:00 +0000</lastBuildDate>",
+		"<atom:link href=\"gemini://example.com/tags/go/rss.xml\"",
+	} {
+		if !strings.Contains(feed, want) {
+			t.Errorf("tags/go/rss.xml: missing %q in %q", want, feed)
+		}
+	}
+	second := strings.Index(feed, "<link>gemini://example.com/posts/p2.gmi</link>")
+	first := strings.Index(feed, "<link>gemini://example.com/posts/p1.gmi</link>")
+	if second == -1 || first == -1 || second > first {
+		t.Errorf("tags/go/rss.xml: got %q, want items of p2 and p1 in this order", feed)
+	}
+	if strings.Contains(output["tags/gemini/rss.xml"], "posts/p2.gmi") {
+		t.Errorf("tags/gemini/rss.xml: lists a post not tagged gemini")
+	}
+}
+
+func TestTaxonomyTemplateError(t *testing.T) {
+	files := make(map[string]string)
+	for name, contents := range testSite {
+		files[name] = contents
+	}
+	files["gmnhg/_default/term.gotmpl"] = "# {{ .Term.Name }}\n{{ fail \"broken\" }}"
+	chdirSite(t, files)
+	_, err := buildSite(buildOptions{outputDir: "output", jobs: 1})
+	if err == nil {
+		t.Fatal("got no error for a failing term template")
+	}
+	// errors point to the term page, as there's no content file;
+	// categories are rendered before tags
+	want := "categories/misc/index.gmi: template: _default/term:2:"
+	if msg := err.Error(); !strings.Contains(msg, want) {
+		t.Errorf("got %q, want an error starting with %q", msg, want)
+	}
+}
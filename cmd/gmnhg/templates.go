@@ -16,9 +16,14 @@
 package main
 
 import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
 	"text/template"
 
 	"github.com/Masterminds/sprig/v3"
+	gemini "github.com/tdemin/gmnhg"
 	"github.com/tdemin/gmnhg/internal/gmnhg"
 )
 
@@ -32,9 +37,130 @@ func defineFuncMap() template.FuncMap {
 	fm["sortPosts"] = gmnhg.SortRev
 	fm["sort"] = gmnhg.Sort
 	fm["sortRev"] = gmnhg.SortRev
+	fm["gmiLink"] = gmiLink
+	fm["truncateGemtext"] = truncateGemtext
+	fm["wordCount"] = func(text interface{}) int {
+		return gmnhg.WordCount(gemtextBytes(text))
+	}
+	fm["readingTime"] = func(text interface{}) int {
+		return gmnhg.ReadingTime(gemtextBytes(text))
+	}
+	fm["where"] = gmnhg.Where
+	fm["first"] = first
+	fm["groupByYear"] = func(posts gmnhg.Posts) []gmnhg.PostGroup {
+		return posts.GroupByDate("2006")
+	}
+	// overridden with site settings by siteFuncMap
+	for name, fn := range siteFuncMap(SiteConfig{}, gemini.Options{}) {
+		fm[name] = fn
+	}
 	return fm
 }
 
+// siteFuncMap returns template functions depending on the site config:
+// absURL and relURL resolve URLs against the gmnhg base URL (falling
+// back to the Hugo one), and markdownify renders Markdown to Gemtext
+// with the site renderer options.
+func siteFuncMap(conf SiteConfig, options gemini.Options) template.FuncMap {
+	baseURL := conf.Gmnhg.BaseURL
+	if baseURL == "" {
+		baseURL = conf.BaseURL
+	}
+	return template.FuncMap{
+		"absURL": func(ref string) (string, error) {
+			u, _, err := resolveURL(baseURL, ref)
+			if err != nil {
+				return "", err
+			}
+			return u.String(), nil
+		},
+		"relURL": func(ref string) (string, error) {
+			u, base, err := resolveURL(baseURL, ref)
+			if err != nil {
+				return "", err
+			}
+			if u.Scheme == base.Scheme && u.Host == base.Host {
+				u.Scheme, u.Host, u.User = "", "", nil
+			}
+			return u.String(), nil
+		},
+		"markdownify": func(md string) (string, error) {
+			gemtext, err := gemini.RenderMarkdownWithOptions([]byte(md), options)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimRight(string(gemtext), "\n"), nil
+		},
+	}
+}
+
+// resolveURL resolves ref against baseURL like Hugo does: paths with no
+// leading slash are relative to the base URL path, while URLs with a
+// scheme are left as is. The parsed base URL is returned along with it.
+func resolveURL(baseURL, ref string) (resolved, base *url.URL, err error) {
+	base, err = url.Parse(strings.TrimSuffix(baseURL, "/") + "/")
+	if err != nil {
+		return nil, nil, err
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.IsAbs() {
+		return u, base, nil
+	}
+	return base.ResolveReference(u), base, nil
+}
+
+// gemtextBytes converts Gemtext passed to template functions, such as
+// .Post or a string, to bytes.
+func gemtextBytes(text interface{}) []byte {
+	switch text := text.(type) {
+	case []byte:
+		return text
+	case string:
+		return []byte(text)
+	}
+	return []byte(fmt.Sprint(text))
+}
+
+// gmiLink returns a Gemtext link line.
+func gmiLink(url string, label ...string) string {
+	return strings.TrimSpace("=> " + url + " " + strings.Join(label, " "))
+}
+
+// truncateGemtext returns the first n lines of Gemtext, leaving out a
+// preformatted block that would be cut.
+func truncateGemtext(n int, text interface{}) string {
+	return string(gmnhg.TruncateGemtext(gemtextBytes(text), n))
+}
+
+var sprigFirst = sprig.TxtFuncMap()["mustFirst"].(func(interface{}) (interface{}, error))
+
+// first returns the first n elements of a list like the Hugo function,
+// e.g. first 5 .Posts. Given a list only, it returns its first element
+// like the sprig function it replaces.
+func first(args ...interface{}) (interface{}, error) {
+	if len(args) == 1 {
+		return sprigFirst(args[0])
+	}
+	if len(args) != 2 {
+		return nil, fmt.Errorf("first: expected a number and a list")
+	}
+	n, ok := args[0].(int)
+	if !ok || n < 0 {
+		return nil, fmt.Errorf("first: expected a non-negative number, got %v", args[0])
+	}
+	list := reflect.ValueOf(args[1])
+	if list.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("first: expected a list, got %T", args[1])
+	}
+	if n > list.Len() {
+		n = list.Len()
+	}
+	return list.Slice(0, n).Interface(), nil
+}
+
 var defaultSingleTemplate = mustParseTmpl("single", `{{ with .Metadata.Title }}# {{.}}
 
 {{ end }}{{ if not .Metadata.Date.IsZero }}{{ .Metadata.Date.Format "2006-01-02 15:04" }}
@@ -45,12 +171,36 @@ var defaultIndexTemplate = mustParseTmpl("index", `# {{ or .Site.GmnhgTitle (or
 {{ with .Content }}
 {{ printf "%s" . }}{{- end }}
 
+{{- if gt .Paginator.TotalPages 1 }}
+{{- /* links are root-relative, as pages of the index are in subdirs */}}
+{{ range $p := .Paginator.Posts }}=> /{{ $p.Link }} {{ if not $p.Metadata.Date.IsZero }}
+{{- $p.Metadata.Date.Format "2006-01-02 15:04" }} - {{end}}{{ if $p.Metadata.Title }}{{ $p.Metadata.Title }}{{else}}{{ $p.Link }}{{end}}
+{{ end }}
+{{ with .Paginator.Prev }}=> {{ . }} Previous page
+{{ end }}{{ with .Paginator.Next }}=> {{ . }} Next page
+{{ end }}
+{{- else }}
+{{- /* links are relative to the language subdir of the index */ -}}
+{{- $prefix := print (trimPrefix "/" .Dirname) "/" }}
 {{- range $dir, $posts := .Posts }}{{ if and (ne $dir "/") (eq (dir $dir) "/") }}
 Index of {{ trimPrefix "/" $dir }}:
 
-{{ range $p := $posts | sortPosts }}=> {{ $p.Link }} {{ if not $p.Metadata.Date.IsZero }}
+{{ range $p := $posts | sortPosts }}=> {{ trimPrefix $prefix $p.Link }} {{ if not $p.Metadata.Date.IsZero }}
 {{- $p.Metadata.Date.Format "2006-01-02 15:04" }} - {{end}}{{ if $p.Metadata.Title }}{{ $p.Metadata.Title }}{{else}}{{ $p.Link }}{{end}}
-{{ end }}{{ end }}{{ end -}}
+{{ end }}{{ end }}{{ end }}
+{{- end -}}
+`)
+
+var defaultArchiveTemplate = mustParseTmpl("archive", `# {{ or .Site.GmnhgTitle (or .Site.Title "Site") }} archive
+
+{{- /* links are relative to the language subdir of the archive */ -}}
+{{- $prefix := print (trimPrefix "/" .Dirname) "/" }}
+{{- range .Posts.GroupByDate "2006" }}
+
+## {{ .Key }}
+{{ range .Posts }}
+=> {{ trimPrefix $prefix .Link }} {{ .Metadata.Date.Format "2006-01-02" }} - {{ or .Metadata.Title .Link }}
+{{- end }}{{ end }}
 `)
 
 var defaultRssTemplate = mustParseTmpl("rss", `{{- $Site := .Site -}}
@@ -68,8 +218,8 @@ var defaultRssTemplate = mustParseTmpl("rss", `{{- $Site := .Site -}}
     <description>Recent content{{ with $Dirname }} in {{ . }}{{end}}{{ with $SiteTitle }} on {{ . }}{{end}}</description>
     <generator>gmnhg</generator>{{ with $Site.LanguageCode }}
     <language>{{ html .}}</language>{{end}}{{ with $Site.Copyright }}
-    <copyright>{{ html . }}</copyright>{{end}}
-    <lastBuildDate>{{ now.Format "Mon, 02 Jan 2006 15:04:05 -0700" }}</lastBuildDate>
+    <copyright>{{ html . }}</copyright>{{end}}{{ with .Posts.Lastmod }}{{ if not .IsZero }}
+    <lastBuildDate>{{ .Format "Mon, 02 Jan 2006 15:04:05 -0700" }}</lastBuildDate>{{end}}{{end}}
     {{ printf "<atom:link href=%q rel=\"self\" type=\"application/rss+xml\" />" $RssURL }}
     {{ range $i, $p := .Posts | sortPosts }}{{ if lt $i 25 }}
     {{- $RelURL := trimPrefix "/" $p.Link | html -}}
@@ -79,9 +229,43 @@ var defaultRssTemplate = mustParseTmpl("rss", `{{- $Site := .Site -}}
       <link>{{ $AbsURL }}</link>
       <pubDate>{{ $p.Metadata.Date.Format "Mon, 02 Jan 2006 15:04:05 -0700" }}</pubDate>
       <guid>{{ $AbsURL }}</guid>
-      <description>{{ html $p.Metadata.Summary }}</description>
+      <description>{{ html $p.Summary }}</description>
     </item>
     {{end}}{{end}}
   </channel>
 </rss>
 `)
+
+// built-in shortcodes, overridable with templates under shortcodes/
+var defaultShortcodeTemplates = map[string]*template.Template{
+	"figure": mustParseTmpl("shortcodes/figure", `{{ $src := or (.Get "src") (.Get 0) -}}
+=> {{ or (.Get "link") $src }} {{ or (.Get "caption") (.Get "title") (.Get "alt") $src }}`),
+	"gist": mustParseTmpl("shortcodes/gist", `{{ $user := or (.Get "user") (.Get 0) -}}
+{{ $id := or (.Get "id") (.Get 1) -}}
+=> https://gist.github.com/{{ $user }}/{{ $id }} Gist {{ or (.Get "file") (.Get 2) $id }} by {{ $user }}`),
+	"highlight": mustParseTmpl("shortcodes/highlight", "```{{ .Get 0 }}\n{{ trim .Inner }}\n```"),
+	"tweet": mustParseTmpl("shortcodes/tweet", `{{ $user := or (.Get "user") (.Get 0) -}}
+=> https://twitter.com/{{ $user }}/status/{{ or (.Get "id") (.Get 1) }} Tweet by @{{ $user }}`),
+	"vimeo":   mustParseTmpl("shortcodes/vimeo", `=> https://vimeo.com/{{ or (.Get "id") (.Get 0) }} {{ or (.Get "title") "Vimeo video" }}`),
+	"youtube": mustParseTmpl("shortcodes/youtube", `=> https://www.youtube.com/watch?v={{ or (.Get "id") (.Get 0) }} {{ or (.Get "title") "YouTube video" }}`),
+}
+
+var defaultTaxonomyTemplate = mustParseTmpl("taxonomy", `# {{ title .Taxonomy }}
+
+{{ range .Terms }}=> {{ .Link }} {{ .Name }} ({{ len .Posts }})
+{{ end -}}
+`)
+
+var defaultTermTemplate = mustParseTmpl("term", `# {{ title .Taxonomy }}: {{ .Term.Name }}
+
+{{ range .Posts | sortPosts }}=> /{{ .Link }} {{ if not .Metadata.Date.IsZero }}
+{{- .Metadata.Date.Format "2006-01-02" }} - {{ end }}{{ or .Metadata.Title .Link }}
+{{ end -}}
+`)
+
+var defaultAliasTemplate = mustParseTmpl("alias", `# {{ or .Page.Metadata.Title "This page has moved" }}
+
+This page has moved to a new location.
+
+=> {{ .Link }} {{ or .Page.Metadata.Title .Link }}
+`)
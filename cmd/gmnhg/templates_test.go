@@ -0,0 +1,149 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tdemin/gmnhg/internal/gmnhg"
+)
+
+func TestFirst(t *testing.T) {
+	tests := []struct {
+		name string
+		args []interface{}
+		want interface{}
+	}{
+		{"first elements", []interface{}{2, []int{1, 2, 3}}, []int{1, 2}},
+		{"more than there are", []interface{}{5, []string{"a"}}, []string{"a"}},
+		{"none", []interface{}{0, []string{"a"}}, []string{}},
+		{"first element", []interface{}{[]string{"a", "b"}}, "a"},
+	}
+	for _, test := range tests {
+		got, err := first(test.args...)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %#v, want %#v", test.name, got, test.want)
+		}
+	}
+
+	errorTests := []struct {
+		name string
+		args []interface{}
+		want string
+	}{
+		{"no arguments", nil, "first: expected a number and a list"},
+		{"too many arguments", []interface{}{1, 2, 3}, "first: expected a number and a list"},
+		{"negative number", []interface{}{-1, []int{1}}, "first: expected a non-negative number, got -1"},
+		{"not a number", []interface{}{"1", []int{1}}, "first: expected a non-negative number, got 1"},
+		{"not a list", []interface{}{1, "abc"}, "first: expected a list, got string"},
+	}
+	for _, test := range errorTests {
+		if _, err := first(test.args...); err == nil || err.Error() != test.want {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestDefaultArchiveTemplate(t *testing.T) {
+	post := func(link, title string, year int) gmnhg.Post {
+		return gmnhg.Post{Link: link, Metadata: gmnhg.Metadata{Title: title, Date: time.Date(year, 3, 1, 0, 0, 0, 0, time.UTC)}}
+	}
+	tests := []struct {
+		name    string
+		dirname string
+		posts   gmnhg.Posts
+		want    string
+	}{
+		{"no posts", "/", nil, "# Test archive\n"},
+		{"one year", "/", gmnhg.Posts{post("posts/a.gmi", "A", 2021), post("posts/b.gmi", "", 2021)},
+			"# Test archive\n\n## 2021\n\n=> posts/a.gmi 2021-03-01 - A\n=> posts/b.gmi 2021-03-01 - posts/b.gmi\n"},
+		{"several years", "/", gmnhg.Posts{post("a.gmi", "A", 2019), post("b.gmi", "B", 2021), post("c.gmi", "C", 2021)},
+			"# Test archive\n\n## 2021\n\n=> b.gmi 2021-03-01 - B\n=> c.gmi 2021-03-01 - C\n\n## 2019\n\n=> a.gmi 2019-03-01 - A\n"},
+		{"language subdir", "/fr", gmnhg.Posts{post("fr/a.gmi", "A", 2021)},
+			"# Test archive\n\n## 2021\n\n=> a.gmi 2021-03-01 - A\n"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := defaultArchiveTemplate.Execute(&buf, map[string]interface{}{
+			"Posts":   test.posts,
+			"Dirname": test.dirname,
+			"Site":    SiteConfig{Title: "Test"}.templateData(),
+		}); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDefaultIndexTemplate(t *testing.T) {
+	date := time.Date(2021, 1, 2, 3, 4, 0, 0, time.UTC)
+	posts := map[string]gmnhg.Posts{
+		"/":      {{Link: "about.gmi"}},
+		"/notes": {{Link: "notes/n.gmi", Metadata: gmnhg.Metadata{Title: "N"}}},
+		"/posts": {{Link: "posts/a.gmi", Metadata: gmnhg.Metadata{Title: "A", Date: date}}, {Link: "posts/b.gmi"}},
+	}
+	frPosts := map[string]gmnhg.Posts{
+		"/posts": {{Link: "fr/posts/a.gmi", Metadata: gmnhg.Metadata{Title: "A"}}},
+	}
+	pageLink := func(page int) string { return pagePath("/", page) }
+	single := gmnhg.Paginate(nil, 0, pageLink)[0]
+	paged := gmnhg.Paginate(posts["/posts"], 1, pageLink)
+	tests := []struct {
+		name      string
+		dirname   string
+		posts     map[string]gmnhg.Posts
+		paginator gmnhg.Paginator
+		content   string
+		want      string
+	}{
+		{"unpaginated", "/", posts, single, "",
+			"# Test\n\nIndex of notes:\n\n=> notes/n.gmi N\n\nIndex of posts:\n\n=> posts/a.gmi 2021-01-02 03:04 - A\n=> posts/b.gmi posts/b.gmi\n"},
+		{"unpaginated with content", "/", posts, single, "Hello.\n",
+			"# Test\n\nHello.\n\nIndex of notes:\n\n=> notes/n.gmi N\n\nIndex of posts:\n\n=> posts/a.gmi 2021-01-02 03:04 - A\n=> posts/b.gmi posts/b.gmi\n"},
+		{"language subdir", "/fr", frPosts, single, "",
+			"# Test\n\nIndex of posts:\n\n=> posts/a.gmi A\n"},
+		{"first page", "/", posts, paged[0], "",
+			"# Test\n\n=> /posts/a.gmi 2021-01-02 03:04 - A\n\n=> " + paged[0].Next + " Next page\n"},
+		{"last page", "/", posts, paged[1], "",
+			"# Test\n\n=> /posts/b.gmi posts/b.gmi\n\n=> " + paged[1].Prev + " Previous page\n"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := defaultIndexTemplate.Execute(&buf, map[string]interface{}{
+			"Posts":     test.posts,
+			"Paginator": test.paginator,
+			"Dirname":   test.dirname,
+			"Content":   []byte(test.content),
+			"Site":      SiteConfig{Title: "Test"}.templateData(),
+		}); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
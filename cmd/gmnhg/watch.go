@@ -0,0 +1,354 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tdemin/gmnhg/internal/gmnhg"
+)
+
+// how often the site files are checked for changes
+const watchInterval = 500 * time.Millisecond
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// snapshot holds states of site files by their paths.
+type snapshot map[string]fileState
+
+// takeSnapshot records states of all files gmnhg renders the site from.
+func takeSnapshot() snapshot {
+	snap := make(snapshot)
+	for _, root := range []string{contentBase, templateBase, staticBase} {
+		filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil
+			}
+			snap[filepath.ToSlash(p)] = fileState{info.ModTime(), info.Size()}
+			return nil
+		})
+	}
+	for _, filename := range hugoConfigFiles {
+		if info, err := os.Stat(filename); err == nil && !info.IsDir() {
+			snap[filename] = fileState{info.ModTime(), info.Size()}
+		}
+	}
+	return snap
+}
+
+// fileChange is a file created, modified, or removed since the
+// previous snapshot.
+type fileChange struct {
+	path           string
+	added, removed bool
+}
+
+// changes returns files changed in next compared to s, sorted by path.
+func (s snapshot) changes(next snapshot) []fileChange {
+	var changes []fileChange
+	for p, state := range next {
+		prev, ok := s[p]
+		if !ok {
+			changes = append(changes, fileChange{path: p, added: true})
+		} else if prev != state {
+			changes = append(changes, fileChange{path: p})
+		}
+	}
+	for p := range s {
+		if _, ok := next[p]; !ok {
+			changes = append(changes, fileChange{path: p, removed: true})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].path < changes[j].path
+	})
+	return changes
+}
+
+// watch checks the site files for changes until the program exits,
+// updating the output dir rendered from s. If s is nil, the site failed
+// to build, and is built from scratch on any change.
+func watch(s *site, opts buildOptions) {
+	fmt.Fprintf(os.Stderr, "watching for changes in %s, %s, %s, and the site config\n", contentBase, templateBase, staticBase)
+	prev := takeSnapshot()
+	for {
+		time.Sleep(watchInterval)
+		next := takeSnapshot()
+		changes := prev.changes(next)
+		if len(changes) == 0 {
+			continue
+		}
+		prev = next
+		var err error
+		if s == nil {
+			s, err = buildSite(opts)
+		} else {
+			s, err = s.update(changes)
+		}
+		if err != nil {
+			reportErrors(err)
+		}
+	}
+}
+
+// update renders parts of the site affected by changes, returning the
+// updated site, or s itself if the site failed to build. The site is
+// rebuilt from scratch when the set of pages changes, since links
+// between pages depend on it, and when templates or the site config
+// change.
+func (s *site) update(changes []fileChange) (*site, error) {
+	start := time.Now()
+	needsRebuild := false
+	var pages, indexes, files []fileChange
+	for _, c := range changes {
+		switch {
+		case strings.HasPrefix(c.path, contentBase) && strings.HasSuffix(c.path, ".md"):
+			_, translationPath := s.languageOf(c.path)
+			name := path.Base(translationPath)
+			if c.added || c.removed {
+				needsRebuild = true
+			} else if name == hugoIndexMdFilename || name == geminiIndexMdFilename {
+				indexes = append(indexes, c)
+			} else {
+				pages = append(pages, c)
+			}
+		case strings.HasPrefix(c.path, contentBase), strings.HasPrefix(c.path, staticBase):
+			files = append(files, c)
+		default:
+			// templates and the site config
+			needsRebuild = true
+		}
+	}
+	if !needsRebuild {
+		var err error
+		needsRebuild, err = s.updatePages(pages)
+		if err != nil {
+			return s, err
+		}
+	}
+	if !needsRebuild {
+		var err error
+		needsRebuild, err = s.updateIndexes(indexes)
+		if err != nil {
+			return s, err
+		}
+	}
+	if needsRebuild {
+		fmt.Fprintf(os.Stderr, "rebuilding the site after changes to %d files\n", len(changes))
+		rebuilt, err := buildSite(s.opts)
+		if rebuilt == nil {
+			return s, err
+		}
+		fmt.Fprintf(os.Stderr, "rebuilt the site in %v\n", time.Since(start).Round(time.Millisecond))
+		return rebuilt, err
+	}
+	if err := s.updateFiles(files); err != nil {
+		return s, err
+	}
+	fmt.Fprintf(os.Stderr, "updated the site after changes to %d files in %v\n", len(changes), time.Since(start).Round(time.Millisecond))
+	return s, nil
+}
+
+// updatePages renders modified pages along with their directory
+// indexes and feeds, the root index, taxonomy pages, and the archive.
+// It tells whether the site has to be rebuilt instead, which is the
+// case when pages get published or unpublished, or their aliases or
+// taxonomy terms change.
+func (s *site) updatePages(changes []fileChange) (needsRebuild bool, err error) {
+	if len(changes) == 0 {
+		return false, nil
+	}
+	updated := make(map[string]source)
+	for _, c := range changes {
+		i := s.sourceIndex(c.path)
+		src, ok, err := s.readSource(c.path)
+		if err != nil {
+			return false, err
+		}
+		if i == -1 || !ok || !s.sameLinks(s.sources[i].metadata, src.metadata) {
+			return true, nil
+		}
+		updated[c.path] = src
+	}
+	dirs := make(map[string]bool)
+	// translations of pages link to them, and are rendered again too
+	translated := make(map[string]bool)
+	for i, src := range s.sources {
+		if newSrc, ok := updated[src.path]; ok {
+			post, err := s.renderSource(newSrc)
+			if err != nil {
+				return false, err
+			}
+			s.sources[i] = newSrc
+			s.posts[newSrc.key] = post
+			translated[newSrc.translationPath] = true
+		}
+	}
+	s.linkTranslations()
+	s.groupPosts()
+	languages := make(map[*language]bool)
+	for _, src := range s.sources {
+		if !translated[src.translationPath] {
+			continue
+		}
+		post := s.posts[src.key]
+		if err := s.writePost(src); err != nil {
+			return false, err
+		}
+		if _, ok := updated[src.path]; !ok {
+			continue
+		}
+		languages[src.lang] = true
+		for j, r := range s.redirects {
+			if r.To == "/"+post.Link {
+				s.redirects[j].page = post
+				if err := renderAliasStub(s.out, s.languageConf(src.lang), s.aliasTemplate(), s.redirects[j]); err != nil {
+					return false, err
+				}
+			}
+		}
+		for dirname, posts := range s.topLevelPosts {
+			for _, p := range posts {
+				if p.Link == post.Link {
+					dirs[dirname] = true
+					break
+				}
+			}
+		}
+	}
+	for dirname := range dirs {
+		if _, dir := s.splitDirname(dirname); dir != "/" {
+			if err := s.writeIndex(dirname); err != nil {
+				return false, err
+			}
+		}
+		if err := s.writeFeed(dirname); err != nil {
+			return false, err
+		}
+	}
+	for lang := range languages {
+		if err := s.writeRootIndex(lang); err != nil {
+			return false, err
+		}
+		if err := s.writeTaxonomies(lang); err != nil {
+			return false, err
+		}
+		if err := s.writeArchive(lang); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// sourceIndex returns the index of a page in s.sources, or -1 if the
+// page is not rendered.
+func (s *site) sourceIndex(contentPath string) int {
+	for i, src := range s.sources {
+		if filepath.ToSlash(src.path) == contentPath {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameLinks tells whether pages other than the page itself link to it
+// the same way with both versions of its metadata: by aliases and by
+// taxonomy terms.
+func (s *site) sameLinks(a, b gmnhg.Metadata) bool {
+	if !reflect.DeepEqual(a.Aliases, b.Aliases) {
+		return false
+	}
+	taxonomies := s.conf.Taxonomies
+	if taxonomies == nil {
+		taxonomies = defaultTaxonomies
+	}
+	for _, taxonomy := range taxonomies {
+		if !reflect.DeepEqual(a.Terms(taxonomy), b.Terms(taxonomy)) {
+			return false
+		}
+	}
+	return true
+}
+
+// updateIndexes renders directory indexes with modified _index.md
+// files, telling whether the site has to be rebuilt instead if any of
+// them are published or unpublished.
+func (s *site) updateIndexes(changes []fileChange) (needsRebuild bool, err error) {
+	for _, c := range changes {
+		fileContent, err := ioutil.ReadFile(c.path)
+		if err != nil {
+			return false, err
+		}
+		_, metadata, err := gmnhg.ParseMetadataStrict(fileContent)
+		if err != nil {
+			return false, frontMatterError(c.path, err)
+		}
+		if s.skipPage(metadata) {
+			return true, nil
+		}
+		lang, translationPath := s.languageOf(c.path)
+		if lang == nil {
+			continue
+		}
+		dir := path.Dir(translationPath)
+		if dir == "." {
+			err = s.writeRootIndex(lang)
+		} else if _, ok := s.topLevelPosts[lang.outputPath(dir)]; ok {
+			err = s.writeIndex(lang.outputPath(dir))
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// updateFiles copies modified page resources and static files to the
+// output dir, and removes the deleted ones from it.
+func (s *site) updateFiles(changes []fileChange) error {
+	for _, c := range changes {
+		var paths []string
+		if strings.HasPrefix(c.path, staticBase) {
+			paths = []string{strings.TrimPrefix(c.path, staticBase)}
+		} else {
+			paths = s.resourcePaths(c.path)
+		}
+		for _, rel := range paths {
+			dst := path.Join(s.out.path, rel)
+			if c.removed {
+				if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+				continue
+			}
+			if err := s.out.copyFile(dst, c.path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotChanges(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2021, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	prev := snapshot{
+		"content/b.md":       {day(1), 10},
+		"content/a.md":       {day(1), 10},
+		"gmnhg/single":       {day(1), 10},
+		"static/removed.txt": {day(1), 10},
+		"static/same.txt":    {day(1), 10},
+	}
+	next := snapshot{
+		"content/b.md":    {day(2), 10},
+		"content/a.md":    {day(1), 12},
+		"gmnhg/single":    {day(1), 10},
+		"content/c.md":    {day(2), 10},
+		"static/same.txt": {day(1), 10},
+	}
+	want := []fileChange{
+		{path: "content/a.md"},
+		{path: "content/b.md"},
+		{path: "content/c.md", added: true},
+		{path: "static/removed.txt", removed: true},
+	}
+	if got := prev.changes(next); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := next.changes(next); len(got) != 0 {
+		t.Errorf("got %+v with no changes", got)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	const stale = "stale"
+	tests := []struct {
+		name    string
+		files   map[string]string
+		change  fileChange
+		rebuild bool
+		// output file expected to contain want after the update
+		file, want string
+	}{
+		{"edited page", map[string]string{
+			"content/posts/p2.md": "---\ntitle: Second\ndate: 2021-01-03\ntags: [go]\n---\nEdited.\n",
+		}, fileChange{path: "content/posts/p2.md"}, false, "posts/p2.gmi", "Edited."},
+		{"added page", map[string]string{
+			"content/posts/p4.md": "---\ntitle: Fourth\ndate: 2021-01-05\n---\nAdded.\n",
+		}, fileChange{path: "content/posts/p4.md", added: true}, true, "posts/index.gmi", "=> /posts/p4.gmi Fourth"},
+		{"changed tags", map[string]string{
+			"content/posts/p2.md": "---\ntitle: Second\ndate: 2021-01-03\ntags: [hugo]\n---\nEdited.\n",
+		}, fileChange{path: "content/posts/p2.md"}, true, "tags/hugo/index.gmi", "=> /posts/p2.gmi"},
+		{"changed template", map[string]string{
+			"gmnhg/_default/single.gotmpl": "## {{ .Metadata.Title }}\n",
+		}, fileChange{path: "gmnhg/_default/single.gotmpl"}, true, "posts/p1.gmi", "## First\n"},
+	}
+	for _, test := range tests {
+		chdirSite(t, testSite)
+		s, err := buildSite(buildOptions{outputDir: "output", jobs: 1})
+		if err != nil {
+			t.Fatalf("%s: buildSite: %v", test.name, err)
+		}
+		// pages rendered again lose the marker
+		untouched := filepath.Join("output", "posts", "p1.gmi")
+		if err := ioutil.WriteFile(untouched, []byte(stale), 0644); err != nil {
+			t.Fatal(err)
+		}
+		writeTree(t, ".", test.files)
+		updated, err := s.update([]fileChange{test.change})
+		if err != nil {
+			t.Errorf("%s: update: %v", test.name, err)
+			continue
+		}
+		if rebuilt := updated != s; rebuilt != test.rebuild {
+			t.Errorf("%s: got rebuild %t, want %t", test.name, rebuilt, test.rebuild)
+		}
+		contents, err := ioutil.ReadFile(untouched)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(contents) == stale; got == test.rebuild {
+			t.Errorf("%s: %s rendered again: %t, want %t", test.name, untouched, !got, test.rebuild)
+		}
+		contents, err = ioutil.ReadFile(filepath.Join("output", test.file))
+		if err != nil || !strings.Contains(string(contents), test.want) {
+			t.Errorf("%s: got %s %q, want it to contain %q", test.name, test.file, contents, test.want)
+		}
+	}
+}
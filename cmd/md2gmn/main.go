@@ -18,6 +18,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"os"
 
@@ -32,9 +33,20 @@ func main() {
 		input        string
 		file         *os.File
 		isVersionCmd bool
+		options      gemini.Options
+
+		clampHeadings, skipHTML, markdownTables  bool
+		linkPlacement, linkNumbering, linkDedupe string
 	)
 	flag.StringVar(&input, "f", "", "input file")
 	flag.BoolVar(&isVersionCmd, "version", false, "display version")
+	flag.BoolVar(&clampHeadings, "clamp-headings", false, "render headings deeper than level 3 as level 3")
+	flag.BoolVar(&skipHTML, "skip-html", false, "drop HTML blocks instead of stripping tags")
+	flag.BoolVar(&markdownTables, "markdown-tables", false, "render tables with Markdown-like borders")
+	flag.IntVar(&options.TableColumnWidth, "table-width", 0, "table column width (defaults to 30)")
+	flag.StringVar(&linkPlacement, "links", "paragraph", "where to place links: paragraph, section, or document")
+	flag.StringVar(&linkNumbering, "number-links", "none", "number inline links: none, block, or document")
+	flag.StringVar(&linkDedupe, "dedupe-links", "none", "deduplicate links: none, block, or document")
 	flag.Parse()
 
 	if isVersionCmd {
@@ -56,8 +68,57 @@ func main() {
 		panic(err)
 	}
 
-	content, _ := gmnhg.ParseMetadata(text)
-	geminiContent, err := gemini.RenderMarkdown(content, gemini.Defaults)
+	if clampHeadings {
+		options.Settings |= gemini.ClampHeadings
+	}
+	if skipHTML {
+		options.Settings |= gemini.SkipHTML
+	}
+	if markdownTables {
+		options.Settings |= gemini.MarkdownTables
+	}
+	switch linkPlacement {
+	case "paragraph":
+	case "section":
+		options.Settings |= gemini.LinksAfterSection
+	case "document":
+		options.Settings |= gemini.LinksAtEnd
+	default:
+		fmt.Fprintf(os.Stderr, "unknown link placement %q\n", linkPlacement)
+		os.Exit(2)
+	}
+	switch linkNumbering {
+	case "none":
+	case "block":
+		options.Settings |= gemini.NumberLinks
+	case "document":
+		options.Settings |= gemini.NumberLinksPerDocument
+	default:
+		fmt.Fprintf(os.Stderr, "unknown link numbering %q\n", linkNumbering)
+		os.Exit(2)
+	}
+	switch linkDedupe {
+	case "none":
+	case "block":
+		options.Settings |= gemini.DeduplicateLinks
+	case "document":
+		options.Settings |= gemini.DeduplicateLinksPerDocument
+	default:
+		fmt.Fprintf(os.Stderr, "unknown link deduplication mode %q\n", linkDedupe)
+		os.Exit(2)
+	}
+
+	// render the text as is, front matter included, to leave it up to
+	// the user to notice the warning
+	content, _, err := gmnhg.ParseMetadataStrict(text)
+	if err != nil {
+		name := input
+		if name == "" {
+			name = "stdin"
+		}
+		fmt.Fprintf(os.Stderr, "warning: %s: %v\n", name, err)
+	}
+	geminiContent, err := gemini.RenderMarkdownWithOptions(content, options)
 	if err != nil {
 		panic(err)
 	}
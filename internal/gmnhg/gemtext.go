@@ -0,0 +1,135 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package gmnhg
+
+import (
+	"bytes"
+	"strings"
+)
+
+// preformattedToggle starts and ends Gemtext preformatted blocks.
+const preformattedToggle = "```"
+
+// Hugo estimates reading time at 213 words per minute
+const wordsPerMinute = 213
+
+// lineText returns the text of a Gemtext line with no line type marker.
+// Link lines are reduced to their labels.
+func lineText(line string) string {
+	switch {
+	case strings.HasPrefix(line, "=>"):
+		fields := strings.Fields(strings.TrimPrefix(line, "=>"))
+		if len(fields) < 2 {
+			return ""
+		}
+		return strings.Join(fields[1:], " ")
+	case strings.HasPrefix(line, "#"):
+		return strings.TrimLeft(line, "#")
+	case strings.HasPrefix(line, "* "):
+		return line[2:]
+	case strings.HasPrefix(line, ">"):
+		return line[1:]
+	}
+	return line
+}
+
+// WordCount returns the number of words in Gemtext, including the ones
+// in link labels and preformatted blocks.
+func WordCount(gemtext []byte) int {
+	count := 0
+	preformatted := false
+	for _, line := range strings.Split(string(gemtext), "\n") {
+		if strings.HasPrefix(line, preformattedToggle) {
+			preformatted = !preformatted
+			continue
+		}
+		if !preformatted {
+			line = lineText(line)
+		}
+		count += len(strings.Fields(line))
+	}
+	return count
+}
+
+// ReadingTime returns the estimated time to read Gemtext in minutes,
+// rounded up as Hugo does.
+func ReadingTime(gemtext []byte) int {
+	return (WordCount(gemtext) + wordsPerMinute - 1) / wordsPerMinute
+}
+
+// TruncateGemtext returns the first n lines of Gemtext. A preformatted
+// block that would be cut is left out entirely instead.
+func TruncateGemtext(gemtext []byte, n int) []byte {
+	lines := bytes.SplitAfter(gemtext, []byte("\n"))
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if n >= len(lines) {
+		return gemtext
+	}
+	if n < 0 {
+		n = 0
+	}
+	end := n
+	preformatted := false
+	for i, line := range lines[:n] {
+		if bytes.HasPrefix(line, []byte(preformattedToggle)) {
+			if !preformatted {
+				end = i
+			}
+			preformatted = !preformatted
+		}
+	}
+	if !preformatted {
+		end = n
+	}
+	return bytes.Join(lines[:end], nil)
+}
+
+// textWords returns words of Gemtext text, leaving out line type
+// markers, link lines, and preformatted blocks.
+func textWords(gemtext []byte) []string {
+	var words []string
+	preformatted := false
+	for _, line := range strings.Split(string(gemtext), "\n") {
+		if strings.HasPrefix(line, preformattedToggle) {
+			preformatted = !preformatted
+			continue
+		}
+		if preformatted || strings.HasPrefix(line, "=>") {
+			continue
+		}
+		words = append(words, strings.Fields(lineText(line))...)
+	}
+	return words
+}
+
+// PlainText returns the text of Gemtext as a single line, leaving out
+// line type markers, link lines, and preformatted blocks.
+func PlainText(gemtext []byte) string {
+	return strings.Join(textWords(gemtext), " ")
+}
+
+// Summarize returns the first n words of Gemtext text, leaving out link
+// lines and preformatted blocks, and tells whether there are more words
+// left.
+func Summarize(gemtext []byte, n int) (summary string, truncated bool) {
+	words := textWords(gemtext)
+	if len(words) > n {
+		return strings.Join(words[:n], " "), true
+	}
+	return strings.Join(words, " "), false
+}
@@ -0,0 +1,103 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package gmnhg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWordCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		gemtext string
+		want    int
+	}{
+		{"empty", "", 0},
+		{"text", "some words here\n\nand there\n", 5},
+		{"line markers", "# Title here\n* item one\n> quote\n", 5},
+		{"links", "=> /a Link label\n=> /b\n", 2},
+		{"preformatted", "```alt text\nfoo bar\n# not a heading\n```\n", 6},
+	}
+	for _, test := range tests {
+		if got := WordCount([]byte(test.gemtext)); got != test.want {
+			t.Errorf("%s: got %d words, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestReadingTime(t *testing.T) {
+	tests := []struct {
+		words, want int
+	}{
+		{0, 0},
+		{1, 1},
+		{213, 1},
+		{214, 2},
+	}
+	for _, test := range tests {
+		gemtext := []byte(strings.Repeat("word ", test.words))
+		if got := ReadingTime(gemtext); got != test.want {
+			t.Errorf("%d words: got %d minutes, want %d", test.words, got, test.want)
+		}
+	}
+}
+
+func TestTruncateGemtext(t *testing.T) {
+	const preformatted = "a\n```\ncode\n```\nb\n"
+	tests := []struct {
+		name    string
+		gemtext string
+		n       int
+		want    string
+	}{
+		{"fewer lines", "a\nb\nc\n", 2, "a\nb\n"},
+		{"all lines", "a\nb\nc\n", 3, "a\nb\nc\n"},
+		{"more lines", "a\nb\n", 5, "a\nb\n"},
+		{"no trailing newline", "a\nb", 1, "a\n"},
+		{"zero", "a\nb\n", 0, ""},
+		{"negative", "a\nb\n", -1, ""},
+		{"cut preformatted block", preformatted, 3, "a\n"},
+		{"entire preformatted block", preformatted, 4, "a\n```\ncode\n```\n"},
+	}
+	for _, test := range tests {
+		if got := TruncateGemtext([]byte(test.gemtext), test.n); string(got) != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	const gemtext = "=> /a Link\n```\ncode words\n```\n# One two\n> three\n"
+	tests := []struct {
+		n         int
+		want      string
+		truncated bool
+	}{
+		{2, "One two", true},
+		{3, "One two three", false},
+		{10, "One two three", false},
+	}
+	for _, test := range tests {
+		summary, truncated := Summarize([]byte(gemtext), test.n)
+		if summary != test.want || truncated != test.truncated {
+			t.Errorf("%d words: got %q, %t, want %q, %t", test.n, summary, truncated, test.want, test.truncated)
+		}
+	}
+	if got, want := PlainText([]byte(gemtext)), "One two three"; got != want {
+		t.Errorf("PlainText: got %q, want %q", got, want)
+	}
+}
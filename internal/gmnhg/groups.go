@@ -0,0 +1,106 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package gmnhg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PostGroup is a group of posts sharing a key, such as the year they
+// were published in.
+type PostGroup struct {
+	Key   string
+	Posts Posts
+}
+
+// newest returns a copy of posts sorted by date, newest first.
+func (p Posts) newest() Posts {
+	sorted := make(Posts, len(p))
+	copy(sorted, p)
+	sort.Stable(sort.Reverse(sorted))
+	return sorted
+}
+
+// groupBy groups posts, newest first, by the keys returned by keys. A
+// post is put in every group it has a key of, and is left out if it has
+// none. Groups are sorted by key if sortKeys is set, and are in the
+// order of their newest posts otherwise.
+func (p Posts) groupBy(keys func(Post) []string, sortKeys bool) []PostGroup {
+	var groups []PostGroup
+	index := make(map[string]int)
+	for _, post := range p.newest() {
+		for _, key := range keys(post) {
+			i, ok := index[key]
+			if !ok {
+				i = len(groups)
+				index[key] = i
+				groups = append(groups, PostGroup{Key: key})
+			}
+			groups[i].Posts = append(groups[i].Posts, post)
+		}
+	}
+	if sortKeys {
+		sort.SliceStable(groups, func(i, j int) bool {
+			return groups[i].Key < groups[j].Key
+		})
+	}
+	return groups
+}
+
+// GroupByDate groups posts by their date formatted with layout, e.g.
+// "2006" for years or "2006-01" for months, newest posts and groups
+// first. Posts with no date are left out.
+func (p Posts) GroupByDate(layout string) []PostGroup {
+	return p.groupBy(func(post Post) []string {
+		if post.Metadata.Date.IsZero() {
+			return nil
+		}
+		return []string{post.Metadata.Date.Format(layout)}
+	}, false)
+}
+
+// GroupBySection groups posts by their section, sorted by its name.
+// Pages in the root of the content dir are grouped under an empty key.
+func (p Posts) GroupBySection() []PostGroup {
+	return p.groupBy(func(post Post) []string {
+		return []string{post.Section}
+	}, true)
+}
+
+// GroupByParam groups posts by the value of a front matter key, sorted
+// by value, e.g. "series". Posts with a list of values, like "tags",
+// are put in a group for each of them, and posts with no value are left
+// out.
+func (p Posts) GroupByParam(key string) []PostGroup {
+	return p.groupBy(func(post Post) []string {
+		switch value := post.Metadata.Params[strings.ToLower(key)].(type) {
+		case nil:
+			return nil
+		case []string:
+			return value
+		case []interface{}:
+			keys := make([]string, 0, len(value))
+			for _, v := range value {
+				keys = append(keys, fmt.Sprint(v))
+			}
+			return keys
+		default:
+			return []string{fmt.Sprint(value)}
+		}
+	}, true)
+}
@@ -0,0 +1,69 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package gmnhg
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGroups(t *testing.T) {
+	posts := Posts{
+		{Link: "p1", Section: "posts", Metadata: Metadata{
+			Date:   time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC),
+			Params: map[string]interface{}{"series": "b", "tags": []interface{}{"go", "gemini"}},
+		}},
+		{Link: "p2", Section: "notes", Metadata: Metadata{
+			Date:   time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC),
+			Params: map[string]interface{}{"series": "a", "weight": 2},
+		}},
+		{Link: "p3", Metadata: Metadata{
+			Date:   time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC),
+			Params: map[string]interface{}{"tags": []interface{}{"go"}},
+		}},
+		{Link: "p4", Section: "posts", Metadata: Metadata{
+			Params: map[string]interface{}{"series": "a"},
+		}},
+	}
+	tests := []struct {
+		name   string
+		groups []PostGroup
+		want   []string
+	}{
+		{"by year", posts.GroupByDate("2006"), []string{"2021: p3 p2", "2020: p1"}},
+		{"by month", posts.GroupByDate("2006-01"), []string{"2021-03: p3", "2021-01: p2", "2020-12: p1"}},
+		{"by section", posts.GroupBySection(), []string{": p3", "notes: p2", "posts: p1 p4"}},
+		{"by param", posts.GroupByParam("series"), []string{"a: p2 p4", "b: p1"}},
+		{"by list param", posts.GroupByParam("Tags"), []string{"gemini: p1", "go: p3 p1"}},
+		{"by number param", posts.GroupByParam("weight"), []string{"2: p2"}},
+		{"by missing param", posts.GroupByParam("missing"), nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, group := range test.groups {
+			got = append(got, fmt.Sprintf("%s: %s", group.Key, strings.Join(links(group.Posts), " ")))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+	if got, want := links(posts), []string{"p1", "p2", "p3", "p4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("posts reordered: got %v, want %v", got, want)
+	}
+}
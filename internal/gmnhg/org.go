@@ -23,6 +23,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/niklasfasching/go-org/org"
 )
@@ -49,6 +50,26 @@ func parseValue(value interface{}) interface{} {
 	return value
 }
 
+var timeType = reflect.TypeOf(time.Time{})
+
+// date formats accepted in org-mode front matter, most specific first
+var dateFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func parseDate(s string) (time.Time, error) {
+	for _, format := range dateFormats {
+		if t, err := time.Parse(format, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse date %q", s)
+}
+
 var errKeyNotFound = errors.New("cannot find tagged key in struct")
 
 // for key "key" will set either map key "key" or struct field tagged
@@ -62,7 +83,7 @@ func reflectSetKey(mapOrStruct interface{}, tag, key string, value interface{})
 	v := reflect.ValueOf(mapOrStruct).Elem()
 	switch kind := v.Kind(); kind {
 	case reflect.Map:
-		v.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(value))
+		v.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(parseValue(value)))
 	case reflect.Struct:
 		var fieldName string
 		t := v.Type()
@@ -80,7 +101,16 @@ func reflectSetKey(mapOrStruct interface{}, tag, key string, value interface{})
 		if fieldName == "" {
 			return fmt.Errorf("%v: %v %w", tag, key, errKeyNotFound)
 		}
-		v.FieldByName(fieldName).Set(reflect.ValueOf(parseValue(value)))
+		field := v.FieldByName(fieldName)
+		if s, ok := value.(string); ok && field.Type() == timeType {
+			date, err := parseDate(s)
+			if err != nil {
+				return err
+			}
+			field.Set(reflect.ValueOf(date))
+			return nil
+		}
+		field.Set(reflect.ValueOf(parseValue(value)))
 	default:
 		return fmt.Errorf("cannot set key of %v", kind.String())
 	}
@@ -95,18 +125,22 @@ func unmarshalORG(data []byte, p interface{}) (err error) {
 	}
 	for k, v := range document.BufferSettings {
 		var (
-			key   string      = k
+			// go-org reports keys in upper case
+			key   string      = strings.ToLower(k)
 			value interface{} = v
 		)
-		if strings.HasSuffix(k, "[]") {
-			key = k[:len(k)-2]
+		if strings.HasSuffix(key, "[]") {
+			key = key[:len(key)-2]
 			value = strings.Fields(v)
-		} else if k == "tags" || k == "categories" || k == "aliases" {
-			value = strings.Fields(v)
-		} else if k == "date" {
-			value = parseORGDate(v)
+		} else {
+			switch key {
+			case "tags", "categories", "aliases":
+				value = strings.Fields(v)
+			case "date", "publishdate", "expirydate", "lastmod":
+				value = parseORGDate(v)
+			}
 		}
-		if err := reflectSetKey(p, "org", strings.ToLower(key), value); err != nil && !errors.Is(err, errKeyNotFound) {
+		if err := reflectSetKey(p, "org", key, value); err != nil && !errors.Is(err, errKeyNotFound) {
 			return err
 		}
 	}
@@ -0,0 +1,80 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package gmnhg
+
+import "sort"
+
+// Paginator is a single page of a paginated list of posts.
+type Paginator struct {
+	// Posts on the current page, newest first.
+	Posts      Posts
+	PageNumber int
+	TotalPages int
+	TotalPosts int
+	// Links to the first, last, previous, and next pages. Prev and Next
+	// are empty on the first and the last pages respectively.
+	First, Last string
+	Prev, Next  string
+}
+
+// HasPrev returns true if there is a page before the current one.
+func (p Paginator) HasPrev() bool {
+	return p.PageNumber > 1
+}
+
+// HasNext returns true if there is a page after the current one.
+func (p Paginator) HasNext() bool {
+	return p.PageNumber < p.TotalPages
+}
+
+// Paginate sorts posts by date, newest first, and splits them into
+// pages of size posts each. A size of zero or less puts all posts on a
+// single page. link returns the link to a page by its number, starting
+// with 1. At least one page is always returned.
+func Paginate(posts Posts, size int, link func(page int) string) []Paginator {
+	sorted := make(Posts, len(posts))
+	copy(sorted, posts)
+	sort.Stable(sort.Reverse(sorted))
+	if size <= 0 {
+		size = len(sorted)
+	}
+	total := 1
+	if size > 0 && len(sorted) > size {
+		total = (len(sorted) + size - 1) / size
+	}
+	pages := make([]Paginator, total)
+	for i := range pages {
+		start, end := i*size, (i+1)*size
+		if end > len(sorted) {
+			end = len(sorted)
+		}
+		pages[i] = Paginator{
+			Posts:      sorted[start:end],
+			PageNumber: i + 1,
+			TotalPages: total,
+			TotalPosts: len(sorted),
+			First:      link(1),
+			Last:       link(total),
+		}
+		if i > 0 {
+			pages[i].Prev = link(i)
+		}
+		if i < total-1 {
+			pages[i].Next = link(i + 2)
+		}
+	}
+	return pages
+}
@@ -0,0 +1,105 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package gmnhg
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testPosts returns posts linked as p1, p2, and so on, with p1 being
+// the oldest one.
+func testPosts(n int) Posts {
+	posts := make(Posts, n)
+	for i := range posts {
+		posts[i] = Post{
+			Link:     fmt.Sprintf("p%d", i+1),
+			Metadata: Metadata{Date: time.Date(2021, 1, i+1, 0, 0, 0, 0, time.UTC)},
+		}
+	}
+	return posts
+}
+
+func links(posts Posts) []string {
+	links := make([]string, len(posts))
+	for i, post := range posts {
+		links[i] = post.Link
+	}
+	return links
+}
+
+func TestPaginate(t *testing.T) {
+	link := func(page int) string {
+		return fmt.Sprintf("page/%d", page)
+	}
+	tests := []struct {
+		name  string
+		posts int
+		size  int
+		want  [][]string
+	}{
+		{"uneven pages", 5, 2, [][]string{{"p5", "p4"}, {"p3", "p2"}, {"p1"}}},
+		{"even pages", 4, 2, [][]string{{"p4", "p3"}, {"p2", "p1"}}},
+		{"single page", 2, 5, [][]string{{"p2", "p1"}}},
+		{"no page size", 3, 0, [][]string{{"p3", "p2", "p1"}}},
+		{"no posts", 0, 2, [][]string{{}}},
+	}
+	for _, test := range tests {
+		pages := Paginate(testPosts(test.posts), test.size, link)
+		if len(pages) != len(test.want) {
+			t.Errorf("%s: got %d pages, want %d", test.name, len(pages), len(test.want))
+			continue
+		}
+		for i, page := range pages {
+			if got := links(page.Posts); !reflect.DeepEqual(got, test.want[i]) {
+				t.Errorf("%s: page %d: got posts %v, want %v", test.name, i+1, got, test.want[i])
+			}
+			var prev, next string
+			if i > 0 {
+				prev = link(i)
+			}
+			if i < len(pages)-1 {
+				next = link(i + 2)
+			}
+			want := Paginator{
+				Posts:      page.Posts,
+				PageNumber: i + 1,
+				TotalPages: len(test.want),
+				TotalPosts: test.posts,
+				First:      link(1),
+				Last:       link(len(test.want)),
+				Prev:       prev,
+				Next:       next,
+			}
+			if !reflect.DeepEqual(page, want) {
+				t.Errorf("%s: page %d: got %+v, want %+v", test.name, i+1, page, want)
+			}
+			if page.HasPrev() != (prev != "") || page.HasNext() != (next != "") {
+				t.Errorf("%s: page %d: got HasPrev %t, HasNext %t", test.name, i+1, page.HasPrev(), page.HasNext())
+			}
+		}
+	}
+}
+
+func TestPaginateKeepsPosts(t *testing.T) {
+	posts := testPosts(3)
+	Paginate(posts, 2, func(int) string { return "" })
+	if got, want := links(posts), []string{"p1", "p2", "p3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("posts reordered: got %v, want %v", got, want)
+	}
+}
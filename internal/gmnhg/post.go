@@ -18,7 +18,11 @@ package gmnhg
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -29,6 +33,22 @@ type Post struct {
 	Post     []byte
 	Metadata Metadata
 	Link     string
+	// Section is the top-level content dir of the page, empty for pages
+	// in the root of the content dir.
+	Section string
+	// Language is the key of the page language in the site config, and
+	// LanguageCode is its language code.
+	Language     string
+	LanguageCode string
+	// Translations holds the page in other languages, sorted by
+	// language weight.
+	Translations Posts
+	// Summary is set from the summary front matter key, the text of
+	// content before the <!--more--> divider, or the first words of
+	// the page text, in this order. Truncated tells whether there's
+	// more to the page than the summary.
+	Summary   string
+	Truncated bool
 }
 
 // Posts implements sort.Interface.
@@ -48,16 +68,119 @@ func (p Posts) Swap(i, j int) {
 	p[j] = t
 }
 
+// Lastmod returns the time the newest of posts was last changed, going
+// by their lastmod dates where set and their publish dates otherwise.
+// It is zero if none of posts have dates.
+func (p Posts) Lastmod() time.Time {
+	var last time.Time
+	for _, post := range p {
+		date := post.Metadata.Lastmod
+		if date.IsZero() {
+			date = post.Metadata.Date
+		}
+		if date.After(last) {
+			last = date
+		}
+	}
+	return last
+}
+
 // Metadata contains all recognized Hugo properties.
 type Metadata struct {
-	Title      string    `yaml:"title" toml:"title" json:"title" org:"title"`
-	IsDraft    bool      `yaml:"draft" toml:"draft" json:"draft" org:"draft"`
-	Layout     string    `yaml:"layout" toml:"layout" json:"layout" org:"layout"`
-	Date       time.Time `yaml:"date" toml:"date" json:"date" org:"date"`
-	Summary    string    `yaml:"summary" toml:"summary" json:"summary" org:"summary"`
-	IsHeadless bool      `yaml:"headless" toml:"headless" json:"headless" org:"headless"`
+	Title       string    `yaml:"title" toml:"title" json:"title" org:"title"`
+	IsDraft     bool      `yaml:"draft" toml:"draft" json:"draft" org:"draft"`
+	Layout      string    `yaml:"layout" toml:"layout" json:"layout" org:"layout"`
+	Type        string    `yaml:"type" toml:"type" json:"type" org:"type"`
+	Date        time.Time `yaml:"date" toml:"date" json:"date" org:"date"`
+	PublishDate time.Time `yaml:"publishDate" toml:"publishDate" json:"publishDate" org:"publishdate"`
+	ExpiryDate  time.Time `yaml:"expiryDate" toml:"expiryDate" json:"expiryDate" org:"expirydate"`
+	Lastmod     time.Time `yaml:"lastmod" toml:"lastmod" json:"lastmod" org:"lastmod"`
+	Summary     string    `yaml:"summary" toml:"summary" json:"summary" org:"summary"`
+	IsHeadless  bool      `yaml:"headless" toml:"headless" json:"headless" org:"headless"`
+	Tags        []string  `yaml:"tags" toml:"tags" json:"tags" org:"tags"`
+	Categories  []string  `yaml:"categories" toml:"categories" json:"categories" org:"categories"`
+	Aliases     []string  `yaml:"aliases" toml:"aliases" json:"aliases" org:"aliases"`
+
+	// Params contains all front matter keys, including the ones above,
+	// with the keys lowercased like in Hugo.
+	Params map[string]interface{} `yaml:"-" toml:"-" json:"-" org:"-"`
+}
+
+// IsFuture returns true if the page is to be published after now, as
+// set by publishDate, or by date if there's no publishDate.
+func (m Metadata) IsFuture(now time.Time) bool {
+	publishDate := m.PublishDate
+	if publishDate.IsZero() {
+		publishDate = m.Date
+	}
+	return publishDate.After(now)
+}
+
+// IsExpired returns true if the page has expiryDate set before now.
+func (m Metadata) IsExpired(now time.Time) bool {
+	return !m.ExpiryDate.IsZero() && m.ExpiryDate.Before(now)
+}
+
+// Terms returns terms of a taxonomy (like tags or categories) the page
+// is assigned to. Taxonomy is the plural name used as the front matter
+// key.
+func (m Metadata) Terms(taxonomy string) []string {
+	switch taxonomy {
+	case "tags":
+		return m.Tags
+	case "categories":
+		return m.Categories
+	}
+	switch value := m.Params[taxonomy].(type) {
+	case string:
+		return []string{value}
+	case []string:
+		return value
+	case []interface{}:
+		terms := make([]string, 0, len(value))
+		for _, v := range value {
+			if v, ok := v.(string); ok {
+				terms = append(terms, v)
+			}
+		}
+		return terms
+	}
+	return nil
+}
+
+// normalizeParams lowercases top-level front matter keys, and converts
+// YAML maps to maps with string keys, like the ones TOML and JSON
+// produce.
+func normalizeParams(params map[string]interface{}) map[string]interface{} {
+	normalized := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		normalized[strings.ToLower(k)] = normalizeValue(v)
+	}
+	return normalized
+}
+
+func normalizeValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			m[fmt.Sprint(k)] = normalizeValue(v)
+		}
+		return m
+	case map[string]interface{}:
+		for k, v := range value {
+			value[k] = normalizeValue(v)
+		}
+	case []interface{}:
+		for i, v := range value {
+			value[i] = normalizeValue(v)
+		}
+	}
+	return value
 }
 
+var errUnterminated = errors.New("no closing delimiter found")
+
 var (
 	yamlDelimiter   = []byte("---\n")
 	tomlDelimiter   = []byte("+++\n")
@@ -67,7 +190,9 @@ var (
 
 // ParseMetadata extracts TOML/JSON/YAML/org-mode format front matter
 // from Markdown text. If no metadata is found, markdown will be equal
-// to source.
+// to source. Front matter that fails to parse is ignored, in which case
+// markdown will be equal to source as well; use ParseMetadataStrict to
+// detect that.
 //
 // TOML front matter is identified as +++ symbols at the very start of
 // the text, followed by TOML content, followed by another +++ (YAML is
@@ -76,6 +201,73 @@ var (
 // identified as a set of #+KEY: VALUE lines, the first line started
 // with anything else but #+ ends the front matter.
 func ParseMetadata(source []byte) (markdown []byte, metadata Metadata) {
+	markdown, metadata, _ = ParseMetadataStrict(source)
+	return
+}
+
+// FrontMatterError reports front matter that failed to parse.
+type FrontMatterError struct {
+	// Format is one of YAML, TOML, JSON, or org.
+	Format string
+	// Line is the line number in the source text, or zero if unknown.
+	Line int
+	Err  error
+}
+
+func (e *FrontMatterError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: invalid %s front matter: %v", e.Line, e.Format, e.Err)
+	}
+	return fmt.Sprintf("invalid %s front matter: %v", e.Format, e.Err)
+}
+
+func (e *FrontMatterError) Unwrap() error {
+	return e.Err
+}
+
+// YAML and TOML errors mention lines relative to the front matter
+var lineRegex = regexp.MustCompile(`\bline (\d+)`)
+
+// frontMatterError annotates an error of parsing front matter starting
+// at firstLine of the source text.
+func frontMatterError(format string, firstLine int, metadataContent []byte, err error) *FrontMatterError {
+	e := &FrontMatterError{Format: format, Err: err}
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &syntaxErr):
+		// the offset includes the offending character, which may be a
+		// newline itself
+		offset := syntaxErr.Offset
+		if offset > 0 {
+			offset--
+		}
+		e.Line = firstLine + bytes.Count(metadataContent[:offset], []byte{'\n'})
+	case errors.As(err, &typeErr):
+		e.Line = firstLine + bytes.Count(metadataContent[:typeErr.Offset], []byte{'\n'})
+	case format == "YAML" || format == "TOML":
+		msg := lineRegex.ReplaceAllStringFunc(err.Error(), func(s string) string {
+			line, _ := strconv.Atoi(lineRegex.FindStringSubmatch(s)[1])
+			line += firstLine - 1
+			if e.Line == 0 {
+				e.Line = line
+			}
+			return fmt.Sprintf("line %d", line)
+		})
+		// keep line numbers in the message consistent with Line
+		if e.Line > 0 {
+			e.Err = errors.New(msg)
+		}
+	}
+	return e
+}
+
+// ParseMetadataStrict works like ParseMetadata, but returns a
+// *FrontMatterError if the front matter fails to parse, including
+// YAML and TOML front matter missing its closing delimiter.
+func ParseMetadataStrict(source []byte) (markdown []byte, metadata Metadata, err error) {
 	var (
 		blockEnd        int
 		metadataContent []byte
@@ -86,37 +278,53 @@ func ParseMetadata(source []byte) (markdown []byte, metadata Metadata) {
 	if bytes.Index(source, yamlDelimiter) == 0 {
 		blockEnd = bytes.Index(source[len(yamlDelimiter):], yamlDelimiter)
 		if blockEnd == -1 {
-			return
+			return markdown, metadata, &FrontMatterError{Format: "YAML", Line: 1, Err: errUnterminated}
 		}
 		metadataContent = source[len(yamlDelimiter) : blockEnd+len(yamlDelimiter)]
 		if err := yaml.Unmarshal(metadataContent, &metadata); err != nil {
-			return
+			return markdown, metadata, frontMatterError("YAML", 2, metadataContent, err)
+		}
+		if err := yaml.Unmarshal(metadataContent, &metadata.Params); err != nil {
+			return markdown, metadata, frontMatterError("YAML", 2, metadataContent, err)
 		}
+		metadata.Params = normalizeParams(metadata.Params)
 		markdown = source[blockEnd+len(yamlDelimiter)*2:]
 	} else if bytes.Index(source, tomlDelimiter) == 0 {
 		blockEnd = bytes.Index(source[len(tomlDelimiter):], tomlDelimiter)
 		if blockEnd == -1 {
-			return
+			return markdown, metadata, &FrontMatterError{Format: "TOML", Line: 1, Err: errUnterminated}
 		}
 		metadataContent = source[len(tomlDelimiter) : blockEnd+len(tomlDelimiter)]
 		if err := toml.Unmarshal(metadataContent, &metadata); err != nil {
-			return
+			return markdown, metadata, frontMatterError("TOML", 2, metadataContent, err)
+		}
+		if err := toml.Unmarshal(metadataContent, &metadata.Params); err != nil {
+			return markdown, metadata, frontMatterError("TOML", 2, metadataContent, err)
 		}
+		metadata.Params = normalizeParams(metadata.Params)
 		markdown = source[blockEnd+len(yamlDelimiter)*2:]
 	} else if match := jsonObjectRegex.FindIndex(source); match != nil {
 		blockEnd = match[1]
 		metadataContent = source[:blockEnd]
 		if err := json.Unmarshal(metadataContent, &metadata); err != nil {
-			return
+			return markdown, metadata, frontMatterError("JSON", 1, metadataContent, err)
 		}
+		if err := json.Unmarshal(metadataContent, &metadata.Params); err != nil {
+			return markdown, metadata, frontMatterError("JSON", 1, metadataContent, err)
+		}
+		metadata.Params = normalizeParams(metadata.Params)
 		markdown = source[blockEnd:]
 	} else if match := orgModeRegex.FindIndex(source); match != nil {
 		blockEnd = match[1]
 		metadataContent = source[:blockEnd]
 		if err := unmarshalORG(metadataContent, &metadata); err != nil {
-			return
+			return markdown, metadata, frontMatterError("org", 1, metadataContent, err)
+		}
+		metadata.Params = make(map[string]interface{})
+		if err := unmarshalORG(metadataContent, &metadata.Params); err != nil {
+			return markdown, metadata, frontMatterError("org", 1, metadataContent, err)
 		}
 		markdown = source[blockEnd:]
 	}
-	return
+	return markdown, metadata, nil
 }
@@ -0,0 +1,255 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package gmnhg
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseMetadataStrict(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		markdown string
+		title    string
+	}{
+		{"YAML", "---\ntitle: a\n---\nbody", "body", "a"},
+		{"TOML", "+++\ntitle = \"a\"\n+++\nbody", "body", "a"},
+		{"JSON", "{\n\"title\": \"a\"\n}\n\nbody", "body", "a"},
+		{"org", "#+TITLE: a\nbody", "body", "a"},
+		{"no front matter", "body", "body", ""},
+	}
+	for _, test := range tests {
+		markdown, metadata, err := ParseMetadataStrict([]byte(test.source))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if string(markdown) != test.markdown || metadata.Title != test.title {
+			t.Errorf("%s: got %q with title %q, want %q with title %q", test.name,
+				markdown, metadata.Title, test.markdown, test.title)
+		}
+		if test.title != "" && metadata.Params["title"] != test.title {
+			t.Errorf("%s: got title param %v, want %q", test.name, metadata.Params["title"], test.title)
+		}
+	}
+}
+
+func TestFrontMatterErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		format string
+		line   int
+		msg    string
+	}{
+		{"unterminated YAML", "---\ntitle: a\n", "YAML", 1,
+			"line 1: invalid YAML front matter: no closing delimiter found"},
+		{"unterminated TOML", "+++\ntitle = \"a\"\n", "TOML", 1,
+			"line 1: invalid TOML front matter: no closing delimiter found"},
+		{"YAML syntax", "---\ntitle: a\ntags: [x\n---\n", "YAML", 3,
+			"line 3: invalid YAML front matter: yaml: line 3: did not find expected ',' or ']'"},
+		{"YAML type", "---\ntitle: a\ndraft: [1]\n---\n", "YAML", 3,
+			"line 3: invalid YAML front matter: yaml: unmarshal errors:\n  line 3: cannot unmarshal !!seq into bool"},
+		{"TOML syntax", "+++\ntitle = \"a\"\ndate = x\n+++\n", "TOML", 3,
+			"line 3: invalid TOML front matter: toml: line 3 (last key \"date\"): expected value but found \"x\" instead"},
+		{"JSON syntax", "{\n\"title\": \"a\",\n\"draft\": tru\n}\n\nbody", "JSON", 3,
+			"line 3: invalid JSON front matter: invalid character '\\n' in literal true (expecting 'e')"},
+		{"JSON type", "{\n\"title\": \"a\",\n\"draft\": \"yes\"\n}\n\nbody", "JSON", 3,
+			"line 3: invalid JSON front matter: json: cannot unmarshal string into Go struct field Metadata.draft of type bool"},
+	}
+	for _, test := range tests {
+		markdown, _, err := ParseMetadataStrict([]byte(test.source))
+		var fmErr *FrontMatterError
+		if !errors.As(err, &fmErr) {
+			t.Errorf("%s: got error %v, want a *FrontMatterError", test.name, err)
+			continue
+		}
+		if fmErr.Format != test.format || fmErr.Line != test.line || fmErr.Error() != test.msg {
+			t.Errorf("%s: got %s error on line %d: %q, want %s error on line %d: %q", test.name,
+				fmErr.Format, fmErr.Line, fmErr, test.format, test.line, test.msg)
+		}
+		if string(markdown) != test.source {
+			t.Errorf("%s: got content %q, want the entire source", test.name, markdown)
+		}
+	}
+}
+
+func TestIsFuture(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		date        time.Time
+		publishDate time.Time
+		want        bool
+	}{
+		{"no dates", time.Time{}, time.Time{}, false},
+		{"past date", now.Add(-time.Hour), time.Time{}, false},
+		{"future date", now.Add(time.Hour), time.Time{}, true},
+		{"date of now", now, time.Time{}, false},
+		{"past publishDate", now.Add(time.Hour), now.Add(-time.Hour), false},
+		{"future publishDate", now.Add(-time.Hour), now.Add(time.Hour), true},
+		{"publishDate of now", time.Time{}, now, false},
+	}
+	for _, test := range tests {
+		m := Metadata{Date: test.date, PublishDate: test.publishDate}
+		if got := m.IsFuture(now); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIsExpired(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		expiryDate time.Time
+		want       bool
+	}{
+		{"no expiryDate", time.Time{}, false},
+		{"past expiryDate", now.Add(-time.Second), true},
+		{"expiryDate of now", now, false},
+		{"future expiryDate", now.Add(time.Second), false},
+	}
+	for _, test := range tests {
+		m := Metadata{ExpiryDate: test.expiryDate}
+		if got := m.IsExpired(now); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLastmod(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2021, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name  string
+		posts Posts
+		want  time.Time
+	}{
+		{"no posts", nil, time.Time{}},
+		{"no dates", Posts{{}}, time.Time{}},
+		{"newest date", Posts{{Metadata: Metadata{Date: day(2)}}, {Metadata: Metadata{Date: day(3)}}, {Metadata: Metadata{Date: day(1)}}}, day(3)},
+		{"lastmod over date", Posts{{Metadata: Metadata{Date: day(2), Lastmod: day(5)}}, {Metadata: Metadata{Date: day(3)}}}, day(5)},
+		{"newer date than lastmod", Posts{{Metadata: Metadata{Date: day(1), Lastmod: day(2)}}, {Metadata: Metadata{Date: day(3)}}}, day(3)},
+	}
+	for _, test := range tests {
+		if got := test.posts.Lastmod(); !got.Equal(test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOrgDates(t *testing.T) {
+	source := "#+TITLE: a\n#+DATE: <2021-01-02 Sat>\n#+PUBLISHDATE: 2021-02-03\n#+EXPIRYDATE: [2021-03-04 Thu 10:00]\n#+LASTMOD: 2021-04-05T06:07:08Z\nbody"
+	_, metadata, err := ParseMetadataStrict([]byte(source))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2021, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		got  time.Time
+		want time.Time
+	}{
+		{"date", metadata.Date, day(1, 2)},
+		{"publishdate", metadata.PublishDate, day(2, 3)},
+		{"expirydate", metadata.ExpiryDate, day(3, 4)},
+		{"lastmod", metadata.Lastmod, time.Date(2021, 4, 5, 6, 7, 8, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		if !test.got.Equal(test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, test.got, test.want)
+		}
+	}
+
+	_, _, err = ParseMetadataStrict([]byte("#+PUBLISHDATE: soon\nbody"))
+	if want := `invalid org front matter: cannot parse date "soon"`; err == nil || err.Error() != want {
+		t.Errorf("invalid date: got error %v, want %q", err, want)
+	}
+}
+
+func TestNormalizeParams(t *testing.T) {
+	params := map[string]interface{}{
+		"Title": "a",
+		"author": map[interface{}]interface{}{
+			"Name":  "b",
+			"links": []interface{}{map[interface{}]interface{}{"url": "c", 1: "d"}},
+		},
+		"extra": map[string]interface{}{"nested": map[interface{}]interface{}{"Key": true}},
+	}
+	want := map[string]interface{}{
+		"title": "a",
+		"author": map[string]interface{}{
+			"Name":  "b",
+			"links": []interface{}{map[string]interface{}{"url": "c", "1": "d"}},
+		},
+		"extra": map[string]interface{}{"nested": map[string]interface{}{"Key": true}},
+	}
+	if got := normalizeParams(params); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestParams(t *testing.T) {
+	tests := []struct {
+		format string
+		source string
+	}{
+		{"YAML", "---\ntitle: a\ndraft: true\nWeight: 2\nSeries: s\nKeywords: [go, gemini]\n---\nbody"},
+		{"TOML", "+++\ntitle = \"a\"\ndraft = true\nWeight = 2\nSeries = \"s\"\nKeywords = [\"go\", \"gemini\"]\n+++\nbody"},
+		{"JSON", "{\n\"title\": \"a\",\n\"draft\": true,\n\"Weight\": 2,\n\"Series\": \"s\",\n\"Keywords\": [\"go\", \"gemini\"]\n}\n\nbody"},
+		{"org", "#+TITLE: a\n#+DRAFT: true\n#+WEIGHT: 2\n#+SERIES: s\n#+KEYWORDS[]: go gemini\nbody"},
+	}
+	for _, test := range tests {
+		_, metadata, err := ParseMetadataStrict([]byte(test.source))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.format, err)
+			continue
+		}
+		params := metadata.Params
+		// numbers decode to different types in different formats
+		weight, _ := params["weight"].(float64)
+		switch w := params["weight"].(type) {
+		case int:
+			weight = float64(w)
+		case int64:
+			weight = float64(w)
+		}
+		keywords, _ := params["keywords"].([]interface{})
+		if strs, ok := params["keywords"].([]string); ok {
+			for _, k := range strs {
+				keywords = append(keywords, k)
+			}
+		}
+		if params["title"] != "a" || params["draft"] != true || weight != 2 || params["series"] != "s" ||
+			!reflect.DeepEqual(keywords, []interface{}{"go", "gemini"}) {
+			t.Errorf("%s: got params %#v", test.format, params)
+		}
+		if len(params) != 5 {
+			t.Errorf("%s: got %d params, want 5: %#v", test.format, len(params), params)
+		}
+		if !metadata.IsDraft || metadata.Title != "a" {
+			t.Errorf("%s: got draft %t and title %q, want true and %q", test.format, metadata.IsDraft, metadata.Title, "a")
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package gmnhg
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Term is a taxonomy term, like a single tag, along with posts it's
+// assigned to.
+type Term struct {
+	Name string
+	// Slug is the term name converted with Urlize.
+	Slug  string
+	Link  string
+	Posts Posts
+}
+
+// Urlize converts a taxonomy term to a URL path component the way Hugo
+// does: the term is lowercased, spaces are replaced with dashes, and
+// anything but letters, digits, dashes, and underscores is dropped.
+func Urlize(term string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(strings.TrimSpace(term)) {
+		switch {
+		case unicode.IsSpace(c):
+			b.WriteRune('-')
+		case unicode.IsLetter(c), unicode.IsDigit(c), c == '-', c == '_':
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// CollectTerms groups posts by terms of a taxonomy, returning terms
+// sorted by name. Terms differing only in case or punctuation, i.e.
+// having the same Urlize result, are merged; the first spelling found
+// is used as the term name. Term links are left empty.
+func CollectTerms(posts Posts, taxonomy string) []Term {
+	var terms []Term
+	indices := make(map[string]int)
+	for _, p := range posts {
+		seen := make(map[string]bool)
+		for _, name := range p.Metadata.Terms(taxonomy) {
+			slug := Urlize(name)
+			if slug == "" || seen[slug] {
+				continue
+			}
+			seen[slug] = true
+			i, ok := indices[slug]
+			if !ok {
+				i = len(terms)
+				indices[slug] = i
+				terms = append(terms, Term{Name: name, Slug: slug})
+			}
+			terms[i].Posts = append(terms[i].Posts, p)
+		}
+	}
+	sort.SliceStable(terms, func(i, j int) bool {
+		return strings.ToLower(terms[i].Name) < strings.ToLower(terms[j].Name)
+	})
+	return terms
+}
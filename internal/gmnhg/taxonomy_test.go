@@ -0,0 +1,116 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package gmnhg
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUrlize(t *testing.T) {
+	tests := []struct {
+		term string
+		want string
+	}{
+		{"go", "go"},
+		{"Go", "go"},
+		{"Gemini Protocol", "gemini-protocol"},
+		{"  padded  ", "padded"},
+		{"two  spaces", "two--spaces"},
+		{"Hello, World!", "hello-world"},
+		{"C++", "c"},
+		{"snake_case-and-dashes", "snake_case-and-dashes"},
+		{"Café Crème", "café-crème"},
+		{"Привет Мир", "привет-мир"},
+		{"日本語", "日本語"},
+		{"Go 1.18", "go-118"},
+		{"!!!", ""},
+	}
+	for _, test := range tests {
+		if got := Urlize(test.term); got != test.want {
+			t.Errorf("Urlize(%q) = %q, want %q", test.term, got, test.want)
+		}
+	}
+}
+
+func TestMetadataTerms(t *testing.T) {
+	m := Metadata{
+		Tags:       []string{"go"},
+		Categories: []string{"code"},
+		Params: map[string]interface{}{
+			"tags":    []interface{}{"ignored"},
+			"series":  "gemini",
+			"authors": []interface{}{"ann", 1, "bob"},
+			"moods":   []string{"happy"},
+			"weight":  3,
+		},
+	}
+	tests := []struct {
+		taxonomy string
+		want     []string
+	}{
+		{"tags", []string{"go"}},
+		{"categories", []string{"code"}},
+		{"series", []string{"gemini"}},
+		{"authors", []string{"ann", "bob"}},
+		{"moods", []string{"happy"}},
+		{"weight", nil},
+		{"missing", nil},
+	}
+	for _, test := range tests {
+		if got := m.Terms(test.taxonomy); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Terms(%q) = %q, want %q", test.taxonomy, got, test.want)
+		}
+	}
+}
+
+func TestCollectTerms(t *testing.T) {
+	posts := Posts{
+		{Link: "p1", Metadata: Metadata{
+			Tags:       []string{"Go", "gemini", "go"},
+			Categories: []string{"Code"},
+			Params:     map[string]interface{}{"series": "Gemini Setup"},
+		}},
+		{Link: "p2", Metadata: Metadata{
+			Tags:   []string{"go!", "Hugo"},
+			Params: map[string]interface{}{"series": []interface{}{"gemini setup", "Other"}},
+		}},
+		{Link: "p3", Metadata: Metadata{
+			Categories: []string{"code", "Life"},
+			Params:     map[string]interface{}{"series": []interface{}{"!!!"}},
+		}},
+	}
+	tests := []struct {
+		taxonomy string
+		want     []string
+	}{
+		{"tags", []string{"gemini (gemini): p1", "Go (go): p1 p2", "Hugo (hugo): p2"}},
+		{"categories", []string{"Code (code): p1 p3", "Life (life): p3"}},
+		{"series", []string{"Gemini Setup (gemini-setup): p1 p2", "Other (other): p2"}},
+		{"missing", nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, term := range CollectTerms(posts, test.taxonomy) {
+			got = append(got, fmt.Sprintf("%s (%s): %s", term.Name, term.Slug, strings.Join(links(term.Posts), " ")))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.taxonomy, got, test.want)
+		}
+	}
+}
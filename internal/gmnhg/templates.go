@@ -33,7 +33,7 @@ func sortWhatever(sortable interface{}, reverse bool) interface{} {
 	v := reflect.ValueOf(sortable)
 	cpy := reflect.MakeSlice(v.Type(), v.Len(), v.Cap())
 	reflect.Copy(cpy, v)
-	cpyAsInterface := v.Interface()
+	cpyAsInterface := cpy.Interface()
 	if !reverse {
 		sort.Sort(cpyAsInterface.(sort.Interface))
 	} else {
@@ -0,0 +1,223 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package gmnhg
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Where returns posts with the value at key matching a value, like the
+// Hugo where function. key is a dot-separated path of fields, map keys,
+// and methods taking no arguments, e.g. "Metadata.Params.series".
+// args is either the value to compare with, or an operator followed by
+// the value. Supported operators are =, !=, <, <=, >, >=, in, not in,
+// and intersect.
+func Where(posts Posts, key string, args ...interface{}) (Posts, error) {
+	op, match := "=", interface{}(nil)
+	switch len(args) {
+	case 1:
+		match = args[0]
+	case 2:
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("where: operator must be a string, got %T", args[0])
+		}
+		op, match = s, args[1]
+	default:
+		return nil, fmt.Errorf("where: expected a value, or an operator and a value")
+	}
+	filtered := make(Posts, 0, len(posts))
+	for _, post := range posts {
+		value, err := valueAt(reflect.ValueOf(post), key)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := matches(op, value, match)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			filtered = append(filtered, post)
+		}
+	}
+	return filtered, nil
+}
+
+// valueAt returns the value at a dot-separated key of v. Missing map
+// keys produce nil.
+func valueAt(v reflect.Value, key string) (interface{}, error) {
+	for _, name := range strings.Split(strings.TrimPrefix(key, "."), ".") {
+		if method := v.MethodByName(name); method.IsValid() && method.Type().NumIn() == 0 && method.Type().NumOut() == 1 {
+			v = method.Call(nil)[0]
+			continue
+		}
+		for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil, nil
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			field := v.FieldByName(name)
+			if !field.IsValid() || !field.CanInterface() {
+				return nil, fmt.Errorf("where: %s has no field %q", v.Type(), name)
+			}
+			v = field
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return nil, fmt.Errorf("where: can't look up %q in %s", name, v.Type())
+			}
+			// top-level front matter keys are lowercased
+			elem := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+			if !elem.IsValid() {
+				elem = v.MapIndex(reflect.ValueOf(strings.ToLower(name)).Convert(v.Type().Key()))
+			}
+			if !elem.IsValid() {
+				return nil, nil
+			}
+			v = elem
+		default:
+			return nil, fmt.Errorf("where: can't look up %q in %s", name, v.Type())
+		}
+	}
+	return v.Interface(), nil
+}
+
+// matches compares value with match using op.
+func matches(op string, value, match interface{}) (bool, error) {
+	switch op {
+	case "=", "==", "eq":
+		return equal(value, match), nil
+	case "!=", "<>", "ne":
+		return !equal(value, match), nil
+	case "in":
+		return contains(match, value), nil
+	case "not in":
+		return !contains(match, value), nil
+	case "intersect":
+		return intersects(value, match), nil
+	case "<", "lt":
+		c, ok := compare(value, match)
+		return ok && c < 0, nil
+	case "<=", "le":
+		c, ok := compare(value, match)
+		return ok && c <= 0, nil
+	case ">", "gt":
+		c, ok := compare(value, match)
+		return ok && c > 0, nil
+	case ">=", "ge":
+		c, ok := compare(value, match)
+		return ok && c >= 0, nil
+	}
+	return false, fmt.Errorf("where: unknown operator %q", op)
+}
+
+// toFloat converts numbers of any type to float64.
+func toFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+func equal(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	if x, ok := a.(time.Time); ok {
+		y, ok := b.(time.Time)
+		return ok && x.Equal(y)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compare orders numbers, strings, and times, telling whether a and b
+// can be compared at all.
+func compare(a, b interface{}) (int, bool) {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		switch {
+		case !ok:
+			return 0, false
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return strings.Compare(x, y), ok
+	case time.Time:
+		y, ok := b.(time.Time)
+		switch {
+		case !ok:
+			return 0, false
+		case x.Before(y):
+			return -1, true
+		case x.After(y):
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// contains tells whether a list has value, or whether a string has a
+// substring.
+func contains(list, value interface{}) bool {
+	if s, ok := list.(string); ok {
+		sub, ok := value.(string)
+		return ok && strings.Contains(s, sub)
+	}
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return false
+	}
+	for i := 0; i < v.Len(); i++ {
+		if equal(v.Index(i).Interface(), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// intersects tells whether lists a and b share a value.
+func intersects(a, b interface{}) bool {
+	v := reflect.ValueOf(a)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return contains(b, a)
+	}
+	for i := 0; i < v.Len(); i++ {
+		if contains(b, v.Index(i).Interface()) {
+			return true
+		}
+	}
+	return false
+}
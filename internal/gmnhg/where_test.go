@@ -0,0 +1,93 @@
+// This file is part of gmnhg.
+
+// gmnhg is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// gmnhg is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with gmnhg. If not, see <https://www.gnu.org/licenses/>.
+
+package gmnhg
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWhere(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2021, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	posts := Posts{
+		{Link: "p1", Language: "en", Metadata: Metadata{
+			Title: "One", Date: day(1), Tags: []string{"go", "gemini"},
+			Params: map[string]interface{}{"series": "a", "weight": 1},
+		}},
+		{Link: "p2", Language: "fr", Metadata: Metadata{
+			Title: "Two", Date: day(2), Tags: []string{"go"},
+			Params: map[string]interface{}{"series": "b", "weight": 2},
+		}},
+		{Link: "p3", Language: "en", Metadata: Metadata{
+			Title: "Three", Date: day(3),
+			Params: map[string]interface{}{"weight": 3.5},
+		}},
+	}
+	tests := []struct {
+		name string
+		key  string
+		args []interface{}
+		want []string
+	}{
+		{"equal", "Language", []interface{}{"en"}, []string{"p1", "p3"}},
+		{"equal operator", "Language", []interface{}{"=", "en"}, []string{"p1", "p3"}},
+		{"not equal", "Language", []interface{}{"!=", "en"}, []string{"p2"}},
+		{"param", "Metadata.Params.series", []interface{}{"a"}, []string{"p1"}},
+		{"leading dot and capitalized param", ".Metadata.Params.Series", []interface{}{"a"}, []string{"p1"}},
+		{"missing param", "Metadata.Params.series", []interface{}{nil}, []string{"p3"}},
+		{"numbers of different types", "Metadata.Params.weight", []interface{}{">=", 2}, []string{"p2", "p3"}},
+		{"less than", "Metadata.Params.weight", []interface{}{"<", 2.5}, []string{"p1", "p2"}},
+		{"dates", "Metadata.Date", []interface{}{">", day(1)}, []string{"p2", "p3"}},
+		{"method", "Metadata.Date.Day", []interface{}{2}, []string{"p2"}},
+		{"in", "Language", []interface{}{"in", []string{"fr", "x"}}, []string{"p2"}},
+		{"in string", "Metadata.Title", []interface{}{"in", "One Two"}, []string{"p1", "p2"}},
+		{"not in", "Language", []interface{}{"not in", []string{"fr"}}, []string{"p1", "p3"}},
+		{"intersect", "Metadata.Tags", []interface{}{"intersect", []string{"gemini", "x"}}, []string{"p1"}},
+		{"incomparable", "Metadata.Params.series", []interface{}{">", 1}, []string{}},
+	}
+	for _, test := range tests {
+		got, err := Where(posts, test.key, test.args...)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if links := links(got); !reflect.DeepEqual(links, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, links, test.want)
+		}
+	}
+
+	errorTests := []struct {
+		name string
+		key  string
+		args []interface{}
+		want string
+	}{
+		{"no value", "Language", nil, "where: expected a value, or an operator and a value"},
+		{"operator not a string", "Language", []interface{}{1, 2}, "where: operator must be a string, got int"},
+		{"unknown operator", "Language", []interface{}{"~", "en"}, `where: unknown operator "~"`},
+		{"unknown field", "Nope", []interface{}{"x"}, `where: gmnhg.Post has no field "Nope"`},
+		{"field of a string", "Language.x", []interface{}{"x"}, `where: can't look up "x" in string`},
+	}
+	for _, test := range errorTests {
+		_, err := Where(posts, test.key, test.args...)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.want)
+		}
+	}
+}
@@ -43,5 +43,5 @@ func (r Renderer) blockquote(w io.Writer, node *ast.BlockQuote, entering bool) {
 }
 
 func (r Renderer) blockquoteText(w io.Writer, node ast.Node) {
-	w.Write(textWithNewlineReplacement(node, quoteBrPrefix, true))
+	w.Write(r.textWithNewlineReplacement(node, quoteBrPrefix, true))
 }
@@ -21,11 +21,18 @@ import (
 	"github.com/gomarkdown/markdown/ast"
 )
 
+// the deepest heading level defined by the text/gemini spec
+const maxHeadingLevel = 3
+
 func (r Renderer) heading(w io.Writer, node *ast.Heading, entering bool) {
 	if entering {
 		// pad headings with the relevant number of #-s; Gemini spec
 		// used to allow 3 at maximum before a space
-		bufLength := node.Level + 1
+		level := node.Level
+		if r.opts.ClampHeadings && level > maxHeadingLevel {
+			level = maxHeadingLevel
+		}
+		bufLength := level + 1
 		heading := make([]byte, bufLength)
 		heading[len(heading)-1] = ' '
 		for i := 0; i < len(heading)-1; i++ {
@@ -44,7 +44,7 @@ var hardBreakTag = regexp.MustCompile(`< *br */? *>`)
 var escapedHtmlChar = regexp.MustCompile(`(?:^|[^\\\\])&[[:alnum:]]+;`)
 
 func (r Renderer) htmlBlock(w io.Writer, node *ast.HTMLBlock, entering bool) {
-	if entering {
+	if entering && !r.opts.SkipHTML {
 		htmlString := stripHtml(node, []byte{})
 		if len(htmlString) > 0 {
 			w.Write([]byte(htmlString))
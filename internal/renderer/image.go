@@ -24,8 +24,9 @@ import (
 func (r Renderer) image(w io.Writer, node *ast.Image, entering bool) {
 	if entering {
 		w.Write(linkPrefix)
-		w.Write(node.Destination)
+		w.Write([]byte(r.destination(node)))
 		w.Write(space)
-		r.text(w, node, true)
+		r.linkNumber(w, node)
+		r.linkLabel(w, node)
 	}
 }
@@ -23,12 +23,19 @@ import (
 	"github.com/gomarkdown/markdown/ast"
 )
 
+// linkNumber writes the [N] prefix of a numbered link line.
+func (r Renderer) linkNumber(w io.Writer, node ast.Node) {
+	if number, ok := r.state.linkNumbers[node]; ok {
+		fmt.Fprintf(w, "[%d] ", number)
+	}
+}
+
 func (r Renderer) link(w io.Writer, node *ast.Link, entering bool) {
 	if entering {
 		if node.Footnote != nil {
-			fmt.Fprintf(w, "[^%d]: %s", node.NoteID, extractText(node.Footnote))
+			fmt.Fprintf(w, "[^%d]: %s", node.NoteID, r.extractText(node.Footnote))
 		} else {
-			uri, err := url.Parse(string(node.Destination))
+			uri, err := url.Parse(r.destination(node))
 			if err != nil {
 				// TODO: should we skip links with invalid URIs?
 				return
@@ -36,7 +43,8 @@ func (r Renderer) link(w io.Writer, node *ast.Link, entering bool) {
 			w.Write(linkPrefix)
 			w.Write([]byte(uri.String()))
 			w.Write(space)
-			r.text(w, node, true)
+			r.linkNumber(w, node)
+			r.linkLabel(w, node)
 		}
 	}
 }
@@ -60,12 +60,39 @@ func (r Renderer) renderLinks(w io.Writer, links []ast.Node) (count uint) {
 	return
 }
 
+// renderImagesAndLinks renders images and links together, keeping their
+// order.
+func (r Renderer) renderImagesAndLinks(w io.Writer, links []ast.Node) (count uint) {
+	for _, link := range links {
+		switch link := link.(type) {
+		case *ast.Image:
+			r.image(w, link, true)
+		case *ast.Link:
+			if link.Footnote != nil {
+				continue
+			}
+			r.link(w, link, true)
+		}
+		w.Write(lineBreak)
+		count++
+	}
+	return
+}
+
 func (r Renderer) linksList(w io.Writer, links []ast.Node) {
-	for _, renderer := range []func(Renderer, io.Writer, []ast.Node) uint{
+	renderers := []func(Renderer, io.Writer, []ast.Node) uint{
 		Renderer.renderFootnotes,
 		Renderer.renderImages,
 		Renderer.renderLinks,
-	} {
+	}
+	// numbered links are rendered in the order of their numbers
+	if r.opts.NumberLinks {
+		renderers = []func(Renderer, io.Writer, []ast.Node) uint{
+			Renderer.renderFootnotes,
+			Renderer.renderImagesAndLinks,
+		}
+	}
+	for _, renderer := range renderers {
 		linksRendered := renderer(r, w, links)
 		// ensure breaks between link blocks of the same type
 		if linksRendered > 0 {
@@ -74,6 +101,20 @@ func (r Renderer) linksList(w io.Writer, links []ast.Node) {
 	}
 }
 
+// orderedLinksList renders images and links in the order given instead
+// of grouping them by type. Footnotes still make a block of their own.
+func (r Renderer) orderedLinksList(w io.Writer, links []ast.Node) {
+	renderers := []func(Renderer, io.Writer, []ast.Node) uint{
+		Renderer.renderFootnotes,
+		Renderer.renderImagesAndLinks,
+	}
+	for _, renderer := range renderers {
+		if linksRendered := renderer(r, w, links); linksRendered > 0 {
+			w.Write(lineBreak)
+		}
+	}
+}
+
 func (r Renderer) list(w io.Writer, node *ast.List, level int) {
 	// the text/gemini spec included with the current Gemini spec does
 	// not specify anything about the formatting of lists of level >= 2,
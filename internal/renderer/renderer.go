@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"io"
 	"regexp"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/gomarkdown/markdown/ast"
 )
@@ -39,12 +41,93 @@ var emptyLineRegex = regexp.MustCompile(`\A[\s]*\z`)
 
 var lineBreakCharacters = regexp.MustCompile(`[\n\r]+`)
 
-// Renderer implements markdown.Renderer.
-type Renderer struct{}
+// LinkPlacement defines where the renderer puts links blocks.
+type LinkPlacement int
 
-// NewRenderer returns a new Renderer.
-func NewRenderer() Renderer {
-	return Renderer{}
+const (
+	// LinksAfterBlock renders links right after the paragraph or other
+	// block element containing them.
+	LinksAfterBlock LinkPlacement = iota
+	// LinksAfterSection collects links up to the next heading and
+	// renders them right before it, in the order of the text.
+	LinksAfterSection
+	// LinksAtEnd renders all links of a document in a single block at
+	// its end.
+	LinksAtEnd
+)
+
+var referencesHeading = []byte("## References\n\n")
+
+// Options contains renderer preferences.
+type Options struct {
+	// LinkPlacement sets where links blocks get rendered.
+	LinkPlacement LinkPlacement
+	// NumberLinks adds [N] markers after the text of inline links and
+	// images, prefixing the corresponding link lines with the same
+	// number. Numbering restarts with every links block rendered, and
+	// the numbered lines keep the order of their numbers.
+	NumberLinks bool
+	// NumberLinksPerDocument keeps numbering links across the entire
+	// document. Implies NumberLinks.
+	NumberLinksPerDocument bool
+	// DeduplicateLinks renders links and images sharing a destination
+	// once per links block, keeping the most descriptive label.
+	DeduplicateLinks bool
+	// DeduplicateLinksPerDocument skips links already rendered earlier
+	// in the document. Implies DeduplicateLinks, and implies
+	// NumberLinksPerDocument when links are numbered.
+	DeduplicateLinksPerDocument bool
+	// RewriteLink, if set, maps link and image destinations to the ones
+	// to be rendered.
+	RewriteLink func(destination string) string
+	// ClampHeadings renders headings of level 4 and deeper as level 3
+	// headings, the deepest ones Gemtext has.
+	ClampHeadings bool
+	// SkipHTML drops HTML blocks entirely instead of rendering their
+	// text with the tags stripped.
+	SkipHTML bool
+	// MarkdownTables renders tables with Markdown-like pipe borders
+	// instead of the default ASCII box.
+	MarkdownTables bool
+	// TableColumnWidth sets the width at which table cell text gets
+	// wrapped; zero keeps the tablewriter default.
+	TableColumnWidth int
+}
+
+// state holds data collected while rendering a single document.
+type state struct {
+	// links pending to be rendered
+	links []ast.Node
+	// numbers of links rendered with [N] markers in text
+	linkNumbers map[ast.Node]int
+	lastNumber  int
+	// numbers of deduplicated links by their linkKey
+	keyNumbers map[string]int
+	// linkKeys of links already rendered in the document
+	renderedLinks map[string]bool
+}
+
+// Renderer implements markdown.Renderer. A Renderer is meant to render
+// a single document.
+type Renderer struct {
+	opts  Options
+	state *state
+}
+
+// NewRenderer returns a new Renderer configured with opts.
+func NewRenderer(opts Options) Renderer {
+	if opts.DeduplicateLinksPerDocument {
+		opts.DeduplicateLinks = true
+		opts.NumberLinksPerDocument = opts.NumberLinksPerDocument || opts.NumberLinks
+	}
+	if opts.NumberLinksPerDocument {
+		opts.NumberLinks = true
+	}
+	return Renderer{opts: opts, state: &state{
+		linkNumbers:   make(map[ast.Node]int),
+		keyNumbers:    make(map[string]int),
+		renderedLinks: make(map[string]bool),
+	}}
 }
 
 func getNodeDelimiter(node ast.Node) []byte {
@@ -62,7 +145,7 @@ func getNodeDelimiter(node ast.Node) []byte {
 	}
 }
 
-func textWithNewlineReplacement(node ast.Node, replacement []byte, unescapeHtml bool) []byte {
+func (r Renderer) textWithNewlineReplacement(node ast.Node, replacement []byte, unescapeHtml bool) []byte {
 	buf := bytes.Buffer{}
 	delimiter := getNodeDelimiter(node)
 	// special case for footnotes: we want them in the text
@@ -89,7 +172,9 @@ func textWithNewlineReplacement(node ast.Node, replacement []byte, unescapeHtml
 			}
 			buf.Write(leaf.Content)
 		case *ast.HTMLBlock:
-			buf.Write([]byte(stripHtml(node, quotePrefix)))
+			if !r.opts.SkipHTML {
+				buf.Write([]byte(stripHtml(node, quotePrefix)))
+			}
 		default:
 			textWithoutBreaks := lineBreakCharacters.ReplaceAll(leaf.Literal, replacement)
 			if unescapeHtml {
@@ -107,16 +192,28 @@ func textWithNewlineReplacement(node ast.Node, replacement []byte, unescapeHtml
 			switch child := child.(type) {
 			case *ast.List:
 			default:
-				buf.Write(textWithNewlineReplacement(child, replacement, unescapeHtml))
+				buf.Write(r.textWithNewlineReplacement(child, replacement, unescapeHtml))
 			}
 		}
 		buf.Write(delimiter)
 	}
+	if number, ok := r.state.linkNumbers[node]; ok {
+		fmt.Fprintf(&buf, "[%d]", number)
+	}
 	return buf.Bytes()
 }
 
+// linkLabel renders link or image text without its [N] marker.
+func (r Renderer) linkLabel(w io.Writer, node ast.Node) {
+	if node := node.AsContainer(); node != nil {
+		for _, child := range node.Children {
+			w.Write(r.textWithNewlineReplacement(child, space, true))
+		}
+	}
+}
+
 func (r Renderer) text(w io.Writer, node ast.Node, unescapeHtml bool) {
-	w.Write(textWithNewlineReplacement(node, space, unescapeHtml))
+	w.Write(r.textWithNewlineReplacement(node, space, unescapeHtml))
 }
 
 func extractLinks(node ast.Node) (stack []ast.Node) {
@@ -140,6 +237,143 @@ func extractLinks(node ast.Node) (stack []ast.Node) {
 	return stack
 }
 
+// addLinks queues links found in node for rendering, and renders them
+// right away unless configured to put links elsewhere. Paragraphs and
+// lists made of links only are always rendered in place, as there's no
+// text for their links to be moved away from.
+func (r Renderer) addLinks(w io.Writer, node ast.Node) {
+	links := extractLinks(node)
+	if r.opts.LinkPlacement != LinksAfterBlock && isLinksOnly(node) {
+		if links := r.dedupeLinks(links); len(links) > 0 {
+			r.linksList(w, links)
+		}
+		return
+	}
+	r.state.links = append(r.state.links, links...)
+	if r.opts.LinkPlacement == LinksAfterBlock {
+		r.flushLinks(w)
+	}
+}
+
+// flushLinks renders all queued links. Links moved to the end of a
+// section or the document keep the order they appear in the text.
+func (r Renderer) flushLinks(w io.Writer) {
+	if links := r.dedupeLinks(r.state.links); len(links) > 0 {
+		if r.opts.LinkPlacement == LinksAfterBlock {
+			r.linksList(w, links)
+		} else {
+			r.orderedLinksList(w, links)
+		}
+	}
+	r.state.links = nil
+	if !r.opts.NumberLinksPerDocument {
+		r.state.lastNumber = 0
+		r.state.keyNumbers = make(map[string]int)
+	}
+}
+
+// destination returns link or image destination to be rendered.
+func (r Renderer) destination(node ast.Node) string {
+	var destination string
+	switch node := node.(type) {
+	case *ast.Image:
+		destination = string(node.Destination)
+	case *ast.Link:
+		destination = string(node.Destination)
+	}
+	if r.opts.RewriteLink != nil {
+		destination = r.opts.RewriteLink(destination)
+	}
+	return destination
+}
+
+// linkKey identifies links and images by their destination; footnotes
+// have no key.
+func (r Renderer) linkKey(node ast.Node) string {
+	switch node := node.(type) {
+	case *ast.Image:
+		return "image " + r.destination(node)
+	case *ast.Link:
+		if node.Footnote == nil {
+			return "link " + r.destination(node)
+		}
+	}
+	return ""
+}
+
+// labelWeight tells how descriptive a link label is; labels merely
+// repeating the destination are the least descriptive.
+func (r Renderer) labelWeight(node ast.Node) int {
+	buf := bytes.Buffer{}
+	r.linkLabel(&buf, node)
+	label := strings.TrimSpace(buf.String())
+	if label == r.destination(node) {
+		return 0
+	}
+	return utf8.RuneCountInString(label)
+}
+
+// dedupeLinks leaves a single link per destination in place of its
+// first occurrence, choosing the one with the most descriptive label.
+// Links rendered earlier in the document are dropped when deduplicating
+// document-wide.
+func (r Renderer) dedupeLinks(links []ast.Node) []ast.Node {
+	if !r.opts.DeduplicateLinks {
+		return links
+	}
+	deduped := make([]ast.Node, 0, len(links))
+	positions := make(map[string]int)
+	for _, link := range links {
+		key := r.linkKey(link)
+		if key == "" {
+			deduped = append(deduped, link)
+			continue
+		}
+		if r.state.renderedLinks[key] {
+			continue
+		}
+		if i, ok := positions[key]; ok {
+			if r.labelWeight(link) > r.labelWeight(deduped[i]) {
+				deduped[i] = link
+			}
+			continue
+		}
+		positions[key] = len(deduped)
+		deduped = append(deduped, link)
+	}
+	if r.opts.DeduplicateLinksPerDocument {
+		for key := range positions {
+			r.state.renderedLinks[key] = true
+		}
+	}
+	return deduped
+}
+
+// numberLinks assigns numbers to links found in node, to be rendered
+// along with the node text and its links block.
+func (r Renderer) numberLinks(node ast.Node) {
+	if !r.opts.NumberLinks {
+		return
+	}
+	for _, link := range extractLinks(node) {
+		if link, ok := link.(*ast.Link); ok && link.Footnote != nil {
+			continue
+		}
+		if _, ok := r.state.linkNumbers[link]; ok {
+			continue
+		}
+		// deduplicated links share the number of their first occurrence
+		key := r.linkKey(link)
+		if number, ok := r.state.keyNumbers[key]; ok && r.opts.DeduplicateLinks {
+			r.state.linkNumbers[link] = number
+			continue
+		}
+		r.state.lastNumber++
+		r.state.linkNumbers[link] = r.state.lastNumber
+		r.state.keyNumbers[key] = r.state.lastNumber
+	}
+}
+
 func isLinksOnlyList(node *ast.List) bool {
 	for _, child := range node.Children {
 		child, ok := child.(*ast.ListItem)
@@ -159,6 +393,18 @@ func isLinksOnlyList(node *ast.List) bool {
 	return true
 }
 
+// isLinksOnly tells whether node is a paragraph or a list having nothing
+// but links.
+func isLinksOnly(node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.Paragraph:
+		return isLinksOnlyParagraph(node)
+	case *ast.List:
+		return isLinksOnlyList(node)
+	}
+	return false
+}
+
 // RenderNode implements Renderer.RenderNode().
 func (r Renderer) RenderNode(w io.Writer, node ast.Node, entering bool) ast.WalkStatus {
 	// entering in gomarkdown was made to have elements of type switch
@@ -171,11 +417,17 @@ func (r Renderer) RenderNode(w io.Writer, node ast.Node, entering bool) ast.Walk
 	fetchLinks := false
 	switch node := node.(type) {
 	case *ast.BlockQuote:
+		if entering {
+			r.numberLinks(node)
+		}
 		r.blockquote(w, node, entering)
 		fetchLinks = true
 	case *ast.HorizontalRule:
 		r.hr(w, node, entering)
 	case *ast.Heading:
+		if entering && r.opts.LinkPlacement == LinksAfterSection {
+			r.flushLinks(w)
+		}
 		r.heading(w, node, entering)
 		noNewLine = false
 	case *ast.Paragraph:
@@ -183,6 +435,9 @@ func (r Renderer) RenderNode(w io.Writer, node ast.Node, entering bool) ast.Walk
 		// these (should) handle underlying paragraphs themselves
 		case *ast.BlockQuote, *ast.ListItem, *ast.Footnotes:
 		default:
+			if entering && !isLinksOnlyParagraph(node) {
+				r.numberLinks(node)
+			}
 			noNewLine = r.paragraph(w, node, entering)
 			fetchLinks = true
 		}
@@ -197,12 +452,16 @@ func (r Renderer) RenderNode(w io.Writer, node ast.Node, entering bool) ast.Walk
 		// footnotes are rendered as links after the parent paragraph
 		if !node.IsFootnotesList && parentIsDocument && !entering {
 			if !isLinksOnlyList(node) {
+				r.numberLinks(node)
 				r.list(w, node, 0)
 				noNewLine = false
 			}
 			fetchLinks = true
 		}
 	case *ast.Table:
+		if entering {
+			r.numberLinks(node)
+		}
 		r.table(w, node, entering)
 		noNewLine = false
 		fetchLinks = true
@@ -216,10 +475,7 @@ func (r Renderer) RenderNode(w io.Writer, node ast.Node, entering bool) ast.Walk
 		w.Write(lineBreak)
 	}
 	if fetchLinks && !entering {
-		links := extractLinks(node)
-		if len(links) > 0 {
-			r.linksList(w, links)
-		}
+		r.addLinks(w, node)
 	}
 	return ast.GoToNext
 }
@@ -228,4 +484,11 @@ func (r Renderer) RenderNode(w io.Writer, node ast.Node, entering bool) ast.Walk
 func (r Renderer) RenderHeader(w io.Writer, node ast.Node) {}
 
 // RenderFooter implements Renderer.RenderFooter().
-func (r Renderer) RenderFooter(w io.Writer, node ast.Node) {}
+func (r Renderer) RenderFooter(w io.Writer, node ast.Node) {
+	// render links collected from the last section or the entire
+	// document
+	if len(r.state.links) > 0 && r.opts.LinkPlacement == LinksAtEnd {
+		w.Write(referencesHeading)
+	}
+	r.flushLinks(w)
+}
@@ -22,8 +22,8 @@ import (
 	"github.com/olekukonko/tablewriter"
 )
 
-func extractText(node ast.Node) string {
-	return string(textWithNewlineReplacement(node, space, true))
+func (r Renderer) extractText(node ast.Node) string {
+	return string(r.textWithNewlineReplacement(node, space, true))
 }
 
 func (r Renderer) tableHead(t *tablewriter.Table, node *ast.TableHeader) {
@@ -36,7 +36,7 @@ func (r Renderer) tableHead(t *tablewriter.Table, node *ast.TableHeader) {
 			if row := node.Children[0].AsContainer(); row != nil {
 				cells := make([]string, len(row.Children))
 				for i, cell := range row.Children {
-					cells[i] = extractText(cell)
+					cells[i] = r.extractText(cell)
 				}
 				t.SetHeader(cells)
 			}
@@ -50,7 +50,7 @@ func (r Renderer) tableBody(t *tablewriter.Table, node *ast.TableBody) {
 			if row := row.AsContainer(); row != nil {
 				cells := make([]string, len(row.Children))
 				for i, cell := range row.Children {
-					cells[i] = extractText(cell)
+					cells[i] = r.extractText(cell)
 				}
 				t.Append(cells)
 			}
@@ -66,7 +66,14 @@ func (r Renderer) table(w io.Writer, node *ast.Table, entering bool) {
 		// single line and always have a TableBody preceded by a single
 		// TableHeader but we're better off not relying on it
 		t := tablewriter.NewWriter(w)
-		t.SetAutoFormatHeaders(false) // TODO: tablewriter options should probably be configurable
+		t.SetAutoFormatHeaders(false)
+		if r.opts.MarkdownTables {
+			t.SetBorders(tablewriter.Border{Left: true, Right: true})
+			t.SetCenterSeparator("|")
+		}
+		if r.opts.TableColumnWidth > 0 {
+			t.SetColWidth(r.opts.TableColumnWidth)
+		}
 		if node := node.AsContainer(); node != nil {
 			for _, child := range node.Children {
 				switch child := child.(type) {
@@ -38,15 +38,89 @@ const (
 	Defaults Settings = 0
 )
 
+const (
+	// ClampHeadings renders headings of level 4 and deeper as level 3
+	// headings, as Gemtext only defines three heading levels.
+	ClampHeadings Settings = 1 << iota
+	// SkipHTML drops HTML blocks from the output instead of rendering
+	// their text with the tags stripped.
+	SkipHTML
+	// MarkdownTables renders tables with Markdown-like pipe borders
+	// instead of an ASCII box.
+	MarkdownTables
+	// LinksAfterSection renders links blocks at the end of each
+	// heading-delimited section instead of after every paragraph, in
+	// the order they appear in the text. Paragraphs and lists of links
+	// only are still rendered in place.
+	LinksAfterSection
+	// LinksAtEnd renders all links in a single "References" block at
+	// the end of the document, like LinksAfterSection does for
+	// sections. Takes precedence over LinksAfterSection.
+	LinksAtEnd
+	// NumberLinks marks inline links in text with [N] references, and
+	// prefixes the corresponding link lines with the same numbers.
+	// Numbering restarts with every links block.
+	NumberLinks
+	// NumberLinksPerDocument works like NumberLinks, but numbers links
+	// throughout the entire document.
+	NumberLinksPerDocument
+	// DeduplicateLinks renders links sharing a destination once per
+	// links block, keeping the most descriptive label.
+	DeduplicateLinks
+	// DeduplicateLinksPerDocument additionally skips links already
+	// rendered earlier in the document. When combined with NumberLinks,
+	// links are numbered throughout the document.
+	DeduplicateLinksPerDocument
+)
+
+// Options holds renderer preferences that cannot be expressed as
+// Settings flags. The zero value is equivalent to Defaults.
+type Options struct {
+	Settings Settings
+	// TableColumnWidth sets the width at which table cell text gets
+	// wrapped. Zero keeps the default width of 30 characters.
+	TableColumnWidth int
+	// RewriteLink, if set, is called for every link and image
+	// destination; the returned destination gets rendered instead.
+	RewriteLink func(destination string) string
+}
+
+func (o Options) rendererOptions() renderer.Options {
+	placement := renderer.LinksAfterBlock
+	if o.Settings.Has(LinksAtEnd) {
+		placement = renderer.LinksAtEnd
+	} else if o.Settings.Has(LinksAfterSection) {
+		placement = renderer.LinksAfterSection
+	}
+	return renderer.Options{
+		LinkPlacement:               placement,
+		NumberLinks:                 o.Settings.Has(NumberLinks),
+		NumberLinksPerDocument:      o.Settings.Has(NumberLinksPerDocument),
+		DeduplicateLinks:            o.Settings.Has(DeduplicateLinks),
+		DeduplicateLinksPerDocument: o.Settings.Has(DeduplicateLinksPerDocument),
+		ClampHeadings:               o.Settings.Has(ClampHeadings),
+		SkipHTML:                    o.Settings.Has(SkipHTML),
+		MarkdownTables:              o.Settings.Has(MarkdownTables),
+		TableColumnWidth:            o.TableColumnWidth,
+		RewriteLink:                 o.RewriteLink,
+	}
+}
+
 var trailing = []byte("\n\n")
 
 // RenderMarkdown converts Markdown text to Gemtext using gomarkdown. It
 // ignores front matter if any has been provided in the text.
 func RenderMarkdown(md []byte, settings Settings) (geminiText []byte, err error) {
+	return RenderMarkdownWithOptions(md, Options{Settings: settings})
+}
+
+// RenderMarkdownWithOptions works like RenderMarkdown, but takes the
+// complete set of renderer preferences.
+func RenderMarkdownWithOptions(md []byte, options Options) (geminiText []byte, err error) {
 	ast := markdown.Parse(md, parser.NewWithExtensions(parser.CommonExtensions|
 		parser.NoEmptyLineBeforeBlock|
 		parser.Footnotes))
-	content := markdown.Render(ast, renderer.NewRenderer())
+	content := markdown.Render(ast, renderer.NewRenderer(options.rendererOptions()))
 	// strip trailing newlines if any
 	for li := bytes.LastIndex(content, trailing); li != -1; li = bytes.LastIndex(content, trailing) {
 		if li != len(content)-len(trailing) {
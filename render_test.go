@@ -21,6 +21,7 @@ import (
 	"os"
 	"path"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/hexops/gotextdiff"
@@ -35,6 +36,27 @@ var (
 	mdFilenameRegex = regexp.MustCompile(`^(.+)\.md$`)
 )
 
+// renderer options for specific test files; files not listed here are
+// rendered with Defaults
+var testOptions = map[string]Options{
+	"renderer_options": {
+		Settings:         ClampHeadings | SkipHTML | MarkdownTables,
+		TableColumnWidth: 20,
+	},
+	"links_after_section":         {Settings: LinksAfterSection},
+	"links_at_end":                {Settings: LinksAtEnd},
+	"numbered_links":              {Settings: NumberLinks},
+	"numbered_links_document":     {Settings: NumberLinksPerDocument},
+	"deduplicated_links":          {Settings: DeduplicateLinks | NumberLinks},
+	"deduplicated_links_document": {Settings: DeduplicateLinksPerDocument | NumberLinks},
+	"rewritten_links": {RewriteLink: func(destination string) string {
+		if strings.HasSuffix(destination, ".md") {
+			return strings.TrimSuffix(destination, ".md") + ".gmi"
+		}
+		return destination
+	}},
+}
+
 func TestMain(m *testing.M) {
 	// go test implicitly sets cwd to tested package directory; sadly,
 	// this fact is undocumented
@@ -63,7 +85,7 @@ func TestRenderer(t *testing.T) {
 			continue
 		}
 		content, _ := gmnhg.ParseMetadata(mdContents)
-		geminiContent, err := RenderMarkdown(content, Defaults)
+		geminiContent, err := RenderMarkdownWithOptions(content, testOptions[testName])
 		if err != nil {
 			t.Errorf("failed to convert %s Markdown to Gemtext: %v", testName, err)
 		}